@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/USA-RedDragon/relink/internal/relink"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func NewApplyCommand(version, commit string) *cobra.Command {
+	return &cobra.Command{
+		Use:     "apply <plan-file>",
+		Short:   "Replace the files recorded in a plan file with links to their sources",
+		Version: fmt.Sprintf("%s - %s", version, commit),
+		Annotations: map[string]string{
+			"version": version,
+			"commit":  commit,
+		},
+		Args:              cobra.ExactArgs(1),
+		RunE:              runApply,
+		SilenceErrors:     true,
+		DisableAutoGenTag: true,
+	}
+}
+
+func runApply(cmd *cobra.Command, args []string) error {
+	fmt.Printf("relink - %s (%s)\n", cmd.Annotations["version"], cmd.Annotations["commit"])
+
+	plan, err := relink.ReadPlan(args[0])
+	if err != nil {
+		return err
+	}
+
+	// The plan records the directories, mode and link mode it was made for,
+	// so they don't have to be passed again at apply time.
+	err = restoreFlag(cmd, "source", plan.Sources, true)
+	if err != nil {
+		return err
+	}
+	err = restoreFlag(cmd, "target", plan.Targets, true)
+	if err != nil {
+		return err
+	}
+	err = restoreFlag(cmd, "mode", []string{string(plan.Mode)}, false)
+	if err != nil {
+		return err
+	}
+	err = restoreFlag(cmd, "link-mode", []string{string(plan.LinkMode)}, false)
+	if err != nil {
+		return err
+	}
+	err = restoreFlag(cmd, "symlink-style", []string{string(plan.SymlinkStyle)}, false)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	err = relink.Apply(cfg, plan)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Plan applied", "path", args[0])
+
+	return nil
+}
+
+// restoreFlag sets a flag to the value recorded in the plan, or, if the flag
+// was given, checks that it matches the plan. Paths are compared absolute.
+func restoreFlag(cmd *cobra.Command, name string, values []string, paths bool) error {
+	flag := cmd.Flags().Lookup(name)
+	if flag == nil {
+		return fmt.Errorf("missing %s flag", name)
+	}
+	sliceValue, isSlice := flag.Value.(pflag.SliceValue)
+
+	if flag.Changed {
+		given := []string{flag.Value.String()}
+		if isSlice {
+			given = sliceValue.GetSlice()
+		}
+		for i := range given {
+			if paths {
+				abs, err := filepath.Abs(given[i])
+				if err != nil {
+					return fmt.Errorf("failed to get absolute path for %s: %w", name, err)
+				}
+				given[i] = abs
+			}
+		}
+		if !slices.Equal(given, values) {
+			return fmt.Errorf("%s %s does not match the plan's %s %s", name, strings.Join(given, ", "), name, strings.Join(values, ", "))
+		}
+		return nil
+	}
+	// Leave the flag unset rather than set to an empty value
+	if len(values) == 0 {
+		return nil
+	}
+
+	var err error
+	if isSlice {
+		err = sliceValue.Replace(values)
+	} else {
+		err = flag.Value.Set(values[0])
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set %s from plan: %w", name, err)
+	}
+	flag.Changed = true
+	return nil
+}
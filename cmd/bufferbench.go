@@ -6,6 +6,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/USA-RedDragon/relink/internal/config"
 	"github.com/USA-RedDragon/relink/internal/relink"
 	"github.com/spf13/cobra"
 )
@@ -27,6 +28,15 @@ func NewBufferBenchCommand(version, commit string) *cobra.Command {
 func runBufferBench(cmd *cobra.Command, _ []string) error {
 	fmt.Printf("relink - %s (%s)\n", cmd.Annotations["version"], cmd.Annotations["commit"])
 
+	algorithm, err := cmd.Flags().GetString("hash-algorithm")
+	if err != nil {
+		return err
+	}
+	hashAlgorithm := config.HashAlgorithm(algorithm)
+	if _, err := relink.NewHash(hashAlgorithm); err != nil {
+		return err
+	}
+
 	// Create temporary 1gib file in the current directory
 	f, err := os.CreateTemp(".", "bufferbench-")
 	if err != nil {
@@ -62,7 +72,7 @@ func runBufferBench(cmd *cobra.Command, _ []string) error {
 
 	for i, bufsize := range sizes {
 		start := time.Now()
-		if _, err := relink.HashFile(f.Name(), bufsize, nil); err != nil {
+		if _, err := relink.HashFile(f.Name(), hashAlgorithm, bufsize, nil); err != nil {
 			return fmt.Errorf("failed to hash file: %w", err)
 		}
 		duration := time.Since(start)
@@ -79,6 +89,7 @@ func runBufferBench(cmd *cobra.Command, _ []string) error {
 		}
 	}
 
+	fmt.Printf("Hash algorithm: %s\n", hashAlgorithm)
 	fmt.Printf("Optimal buffer size: %d bytes\n", sizes[optimalIndex])
 	fmt.Printf("Optimal speed: %.2f MiB/s\n", optimalSpeed)
 
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/USA-RedDragon/relink/internal/config"
+	"github.com/USA-RedDragon/relink/internal/relink"
+	"github.com/USA-RedDragon/relink/internal/relink/cache"
+	"github.com/USA-RedDragon/relink/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+func NewCacheCommand(version, commit string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "cache",
+		Short:   "Inspect and maintain a sqlite or bolt hash cache",
+		Version: fmt.Sprintf("%s - %s", version, commit),
+		Annotations: map[string]string{
+			"version": version,
+			"commit":  commit,
+		},
+		SilenceErrors:     true,
+		DisableAutoGenTag: true,
+	}
+	cmd.AddCommand(newCacheSubcommand(version, commit, "stats", "Show the number of entries, hashes, and duplicates in the cache", cobra.NoArgs, runCacheStats))
+	cmd.AddCommand(newCacheSubcommand(version, commit, "prune", "Remove entries for source files that no longer exist or have changed", cobra.NoArgs, runCachePrune))
+	cmd.AddCommand(newCacheSubcommand(version, commit, "vacuum", "Reclaim the space left behind by removed entries", cobra.NoArgs, runCacheVacuum))
+	cmd.AddCommand(newCacheSubcommand(version, commit, "export <file>", "Write every cache entry to a JSON Lines file", cobra.ExactArgs(1), runCacheExport))
+	cmd.AddCommand(newCacheSubcommand(version, commit, "import <file>", "Add the entries from a JSON Lines export to the cache", cobra.ExactArgs(1), runCacheImport))
+	return cmd
+}
+
+func newCacheSubcommand(version, commit, use, short string, args cobra.PositionalArgs, run func(*cobra.Command, cache.Cache, []string) error) *cobra.Command {
+	return &cobra.Command{
+		Use:     use,
+		Short:   short,
+		Version: fmt.Sprintf("%s - %s", version, commit),
+		Annotations: map[string]string{
+			"version": version,
+			"commit":  commit,
+		},
+		Args: args,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fmt.Printf("relink - %s (%s)\n", cmd.Annotations["version"], cmd.Annotations["commit"])
+
+			cc, err := openCache(cmd)
+			if err != nil {
+				return err
+			}
+			err = run(cmd, cc, args)
+			if closeErr := cc.Close(); err == nil {
+				err = closeErr
+			}
+			return err
+		},
+		SilenceErrors:     true,
+		DisableAutoGenTag: true,
+	}
+}
+
+// openCache opens the cache from the config. The cache commands don't need a
+// source or target, so the config is loaded without them.
+func openCache(cmd *cobra.Command) (cache.Cache, error) {
+	cfg, err := loadConfigWithoutPaths(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.CacheType == config.CacheTypeMemory || cfg.CachePath == "" || cfg.CachePath == ":memory:" {
+		return nil, relink.ErrCacheNotPersistent
+	}
+
+	return relink.OpenCache(cfg.CacheType, cfg.CachePath)
+}
+
+func runCacheStats(_ *cobra.Command, cc cache.Cache, _ []string) error {
+	stats, err := relink.GetCacheStats(cc)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Entries:          %d\n", stats.Entries)
+	fmt.Printf("Distinct hashes:  %d\n", stats.Hashes)
+	fmt.Printf("Duplicate groups: %d\n", stats.DuplicateGroups)
+	fmt.Printf("Total size:       %s\n", utils.HumanReadableSize(stats.Bytes))
+	fmt.Printf("Duplicate size:   %s\n", utils.HumanReadableSize(stats.DuplicateBytes))
+
+	return nil
+}
+
+func runCachePrune(_ *cobra.Command, cc cache.Cache, _ []string) error {
+	pruned, err := relink.PruneCache(cc)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Cache pruned", "removed", pruned)
+
+	return nil
+}
+
+func runCacheVacuum(_ *cobra.Command, cc cache.Cache, _ []string) error {
+	err := cc.Vacuum()
+	if err != nil {
+		return fmt.Errorf("failed to vacuum cache: %w", err)
+	}
+
+	slog.Info("Cache vacuumed")
+
+	return nil
+}
+
+func runCacheExport(_ *cobra.Command, cc cache.Cache, args []string) error {
+	f, err := os.OpenFile(args[0], os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+
+	exported, err := relink.ExportCache(cc, f)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write export file: %w", closeErr)
+	}
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Cache exported", "path", args[0], "entries", exported)
+
+	return nil
+}
+
+func runCacheImport(_ *cobra.Command, cc cache.Cache, args []string) error {
+	f, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to open import file: %w", err)
+	}
+	defer f.Close()
+
+	imported, err := relink.ImportCache(cc, f)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Cache imported", "path", args[0], "entries", imported)
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/USA-RedDragon/relink/internal/relink"
+	"github.com/USA-RedDragon/relink/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+func NewPlanCommand(version, commit string) *cobra.Command {
+	return &cobra.Command{
+		Use:     "plan <plan-file>",
+		Short:   "Write the hardlinks relink would create to a plan file",
+		Version: fmt.Sprintf("%s - %s", version, commit),
+		Annotations: map[string]string{
+			"version": version,
+			"commit":  commit,
+		},
+		Args:              cobra.ExactArgs(1),
+		RunE:              runPlan,
+		SilenceErrors:     true,
+		DisableAutoGenTag: true,
+	}
+}
+
+func runPlan(cmd *cobra.Command, args []string) error {
+	fmt.Printf("relink - %s (%s)\n", cmd.Annotations["version"], cmd.Annotations["commit"])
+
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	plan, err := relink.BuildPlan(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = plan.Write(args[0])
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Plan written", "path", args[0], "files", len(plan.Entries), "reclaimable", utils.HumanReadableSize(plan.TotalSize()))
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/USA-RedDragon/relink/internal/config"
+	"github.com/USA-RedDragon/relink/internal/relink"
+	"github.com/spf13/cobra"
+)
+
+func NewRollbackCommand(version, commit string) *cobra.Command {
+	return &cobra.Command{
+		Use:     "rollback [journal]",
+		Short:   "Break the hardlinks recorded in a journal back into independent copies",
+		Version: fmt.Sprintf("%s - %s", version, commit),
+		Annotations: map[string]string{
+			"version": version,
+			"commit":  commit,
+		},
+		Args:              cobra.MaximumNArgs(1),
+		RunE:              runRollback,
+		SilenceErrors:     true,
+		DisableAutoGenTag: true,
+	}
+}
+
+func runRollback(cmd *cobra.Command, args []string) error {
+	fmt.Printf("relink - %s (%s)\n", cmd.Annotations["version"], cmd.Annotations["commit"])
+
+	// Rolling back doesn't need a source or target, so the config is loaded
+	// without them.
+	cfg, err := loadConfigWithoutPaths(cmd)
+	if err != nil {
+		return err
+	}
+	if cfg.BufferSize <= 0 {
+		return config.ErrZeroBufferSize
+	}
+
+	journal := cfg.Journal
+	if len(args) > 0 {
+		journal = args[0]
+	}
+	if journal == "" {
+		return config.ErrNoJournal
+	}
+
+	err = relink.Rollback(journal, cfg.BufferSize)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Rollback completed", "journal", journal)
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -25,24 +26,75 @@ func NewCommand(version, commit string) *cobra.Command {
 		DisableAutoGenTag: true,
 	}
 	cmd.AddCommand(NewBufferBenchCommand(version, commit))
+	cmd.AddCommand(NewPlanCommand(version, commit))
+	cmd.AddCommand(NewApplyCommand(version, commit))
+	cmd.AddCommand(NewRollbackCommand(version, commit))
+	cmd.AddCommand(NewCacheCommand(version, commit))
 	return cmd
 }
 
 func runRoot(cmd *cobra.Command, _ []string) error {
 	fmt.Printf("relink - %s (%s)\n", cmd.Annotations["version"], cmd.Annotations["commit"])
 
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	return relink.Run(cfg)
+}
+
+func loadConfig(cmd *cobra.Command) (*config.Config, error) {
 	c, err := configulator.FromContext[config.Config](cmd.Context())
 	if err != nil {
-		return fmt.Errorf("failed to get config from context")
+		return nil, fmt.Errorf("failed to get config from context")
 	}
 
 	cfg, err := c.Load()
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	err = setupLogger(cfg.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// loadConfigWithoutPaths loads the config for commands that don't walk a
+// source or target, ignoring the validation errors about them. Validation
+// stops at the first error, so the settings these commands use are checked
+// again by the commands themselves.
+func loadConfigWithoutPaths(cmd *cobra.Command) (*config.Config, error) {
+	c, err := configulator.FromContext[config.Config](cmd.Context())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config from context")
+	}
+
+	cfg, err := c.Load()
+	switch {
+	case errors.Is(err, config.ErrNoSource),
+		errors.Is(err, config.ErrNoTarget),
+		errors.Is(err, config.ErrTargetInSelfMode),
+		errors.Is(err, config.ErrSourceNotFound),
+		errors.Is(err, config.ErrSourceAndTargetSame):
+	case err != nil:
+		return nil, err
 	}
 
+	err = setupLogger(cfg.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func setupLogger(level config.LogLevel) error {
 	var logger *slog.Logger
-	switch cfg.LogLevel {
+	switch level {
 	case config.LogLevelDebug:
 		logger = slog.New(tint.NewHandler(os.Stdout, &tint.Options{Level: slog.LevelDebug}))
 	case config.LogLevelInfo:
@@ -51,8 +103,10 @@ func runRoot(cmd *cobra.Command, _ []string) error {
 		logger = slog.New(tint.NewHandler(os.Stderr, &tint.Options{Level: slog.LevelWarn}))
 	case config.LogLevelError:
 		logger = slog.New(tint.NewHandler(os.Stderr, &tint.Options{Level: slog.LevelError}))
+	default:
+		return config.ErrBadLogLevel
 	}
 	slog.SetDefault(logger)
 
-	return relink.Run(cfg)
+	return nil
 }
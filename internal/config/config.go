@@ -3,6 +3,9 @@ package config
 import (
 	"errors"
 	"os"
+	"slices"
+
+	"github.com/USA-RedDragon/relink/internal/utils"
 )
 
 type LogLevel string
@@ -14,33 +17,121 @@ const (
 	LogLevelError LogLevel = "error"
 )
 
+type Mode string
+
+const (
+	ModeTarget Mode = "target"
+	ModeSelf   Mode = "self"
+)
+
+type Canonical string
+
+const (
+	CanonicalOldest       Canonical = "oldest"
+	CanonicalShortestPath Canonical = "shortest-path"
+	CanonicalLowestInode  Canonical = "lowest-inode"
+)
+
+type LinkMode string
+
+const (
+	LinkModeHardlink    LinkMode = "hardlink"
+	LinkModeReflink     LinkMode = "reflink"
+	LinkModeDedupeRange LinkMode = "dedupe-range"
+	LinkModeSymlink     LinkMode = "symlink"
+)
+
+type SymlinkStyle string
+
+const (
+	SymlinkStyleRelative SymlinkStyle = "relative"
+	SymlinkStyleAbsolute SymlinkStyle = "absolute"
+)
+
+type CrossDevice string
+
+const (
+	CrossDeviceSkip    CrossDevice = "skip"
+	CrossDeviceSymlink CrossDevice = "symlink"
+	CrossDeviceReflink CrossDevice = "reflink"
+)
+
+type Metadata string
+
+const (
+	MetadataWarn   Metadata = "warn"
+	MetadataSkip   Metadata = "skip"
+	MetadataRefuse Metadata = "refuse"
+)
+
 type CacheType string
 
 const (
 	CacheTypeMemory CacheType = "memory"
 	CacheTypeSQLite CacheType = "sqlite"
+	CacheTypeBolt   CacheType = "bolt"
+)
+
+type HashAlgorithm string
+
+const (
+	HashAlgorithmBLAKE2b HashAlgorithm = "blake2b"
+	HashAlgorithmBLAKE3  HashAlgorithm = "blake3"
+	HashAlgorithmSHA256  HashAlgorithm = "sha256"
+	HashAlgorithmXXH3    HashAlgorithm = "xxh3"
 )
 
 type Config struct {
-	LogLevel   LogLevel  `name:"log-level" description:"Logging level for the application. One of debug, info, warn, or error" default:"info"`
-	Source     string    `name:"source" description:"Source directory to read the files from"`
-	Target     string    `name:"target" description:"Target directory to write the relinked files to"`
-	HashJobs   int       `name:"hash-jobs" description:"Number of jobs to use for hashing files" default:"4"`
-	BufferSize int       `name:"buffer-size" description:"Buffer size for file checksum operations in bytes" default:"4096"`
-	CacheType  CacheType `name:"cache-type" description:"Cache type to use for storing file hashes. One of memory or sqlite" default:"memory"`
-	CachePath  string    `name:"cache-path" description:"Path to the SQLite database file for caching. Only used if cache-type is sqlite" default:":memory:"`
+	LogLevel        LogLevel      `name:"log-level" description:"Logging level for the application. One of debug, info, warn, or error" default:"info"`
+	Mode            Mode          `name:"mode" description:"What to deduplicate. One of target, which links target files to matching source files, or self, which links duplicates within the sources to one canonical file" default:"target"`
+	Canonical       Canonical     `name:"canonical" description:"How self mode picks the file each duplicate is linked to. One of oldest, shortest-path, or lowest-inode" default:"oldest"`
+	Source          []string      `name:"source" description:"Source directories to read the files from, in priority order. A match in an earlier source is preferred over one in a later source"`
+	Target          []string      `name:"target" description:"Target directories whose files are replaced with hardlinks to matching source files"`
+	SourceInclude   []string      `name:"source-include" description:"Only walk source files matching one of these patterns. Patterns are doublestar globs, or regular expressions when prefixed with regex:, matched against the path relative to the source. Globs without a slash match the file name at any depth"`
+	SourceExclude   []string      `name:"source-exclude" description:"Skip source files and directories matching one of these patterns, using the same syntax as source-include. Excluded directories are not descended into"`
+	TargetInclude   []string      `name:"target-include" description:"Only walk target files matching one of these patterns, using the same syntax as source-include"`
+	TargetExclude   []string      `name:"target-exclude" description:"Skip target files and directories matching one of these patterns, using the same syntax as source-include. Excluded directories are not descended into"`
+	MinSize         string        `name:"min-size" description:"Skip files smaller than this size, like 4KiB or 1MB. Binary units and bare prefixes like 1M are powers of 1024" default:"0"`
+	MaxSize         string        `name:"max-size" description:"Skip files larger than this size, using the same units as min-size. 0 means no limit" default:"0"`
+	HashJobs        int           `name:"hash-jobs" description:"Number of jobs to use for hashing files" default:"4"`
+	BufferSize      int           `name:"buffer-size" description:"Buffer size for file checksum operations in bytes" default:"4096"`
+	HashAlgorithm   HashAlgorithm `name:"hash-algorithm" description:"Hash algorithm used to compare files. One of blake2b, blake3, sha256, or xxh3 (non-cryptographic)" default:"blake2b"`
+	PartialHashSize int           `name:"partial-hash-size" description:"Bytes read from the start and end of a file for the partial hash checked before the full hash. 0 always hashes the full file" default:"1048576"`
+	CacheType       CacheType     `name:"cache-type" description:"Cache type to use for storing file hashes. One of memory, sqlite, or bolt" default:"memory"`
+	CachePath       string        `name:"cache-path" description:"Path to the SQLite database or bolt file for caching. Only used if cache-type is sqlite or bolt" default:":memory:"`
+	LinkMode        LinkMode      `name:"link-mode" description:"How duplicate files are replaced. One of hardlink, reflink, which clones the source into an independent copy-on-write file on filesystems like Btrfs and XFS, dedupe-range, which has the kernel verify the contents match before sharing extents and keeps the target's inode and metadata, or symlink, which also works across filesystems" default:"hardlink"`
+	SymlinkStyle    SymlinkStyle  `name:"symlink-style" description:"Whether symlinks point at the source with a relative or absolute path. One of relative or absolute. Only used if link-mode or cross-device is symlink" default:"relative"`
+	CrossDevice     CrossDevice   `name:"cross-device" description:"What to do with a file on a different device than its source, which only the symlink link mode can link. One of skip, which skips it with a warning, symlink, or reflink, which tries a reflink, such as between Btrfs subvolumes, and skips the file if that fails" default:"skip"`
+	Metadata        Metadata      `name:"metadata" description:"What to do when a target's owner, group, mode, ACLs, or extended attributes would not be preserved, since hardlinks and symlinks share the source's and reflinks may not be able to copy them. One of warn, which replaces it with a warning, skip, which skips it with a warning, or refuse, which stops the run" default:"warn"`
+	Verify          bool          `name:"verify" description:"Compare source and target byte-by-byte before replacing the target"`
+	DryRun          bool          `name:"dry-run" description:"Print the files that would be replaced instead of replacing them"`
+	Journal         string        `name:"journal" description:"Path to the append-only journal every replaced file is recorded in before it is replaced, used by the rollback command" default:"relink-journal.jsonl"`
 }
 
 var (
-	ErrBadLogLevel            = errors.New("invalid log level provided")
-	ErrNoSource               = errors.New("no source directory provided")
-	ErrNoTarget               = errors.New("no target directory provided")
-	ErrSourceNotFound         = errors.New("source directory not found")
-	ErrSourceAndTargetSame    = errors.New("source and target directories are the same")
-	ErrZeroBufferSize         = errors.New("buffer size must be greater than 0 bytes")
-	ErrZeroHashJobs           = errors.New("hash jobs must be greater than 0")
-	ErrInvalidCacheType       = errors.New("invalid cache type provided")
-	ErrCachePathWithoutSQLite = errors.New("cache path cannot be set without cache type being sqlite")
+	ErrBadLogLevel             = errors.New("invalid log level provided")
+	ErrNoSource                = errors.New("no source directory provided")
+	ErrNoTarget                = errors.New("no target directory provided")
+	ErrInvalidMode             = errors.New("invalid mode provided")
+	ErrTargetInSelfMode        = errors.New("target directories cannot be set in self mode")
+	ErrInvalidCanonical        = errors.New("invalid canonical file selection provided")
+	ErrSourceNotFound          = errors.New("source directory not found")
+	ErrSourceAndTargetSame     = errors.New("source and target directories are the same")
+	ErrZeroBufferSize          = errors.New("buffer size must be greater than 0 bytes")
+	ErrZeroHashJobs            = errors.New("hash jobs must be greater than 0")
+	ErrNegativePartialHashSize = errors.New("partial hash size cannot be negative")
+	ErrInvalidHashAlgorithm    = errors.New("invalid hash algorithm provided")
+	ErrInvalidLinkMode         = errors.New("invalid link mode provided")
+	ErrInvalidSymlinkStyle     = errors.New("invalid symlink style provided")
+	ErrInvalidCrossDevice      = errors.New("invalid cross-device policy provided")
+	ErrInvalidMetadata         = errors.New("invalid metadata policy provided")
+	ErrInvalidMinSize          = errors.New("invalid minimum file size provided")
+	ErrInvalidMaxSize          = errors.New("invalid maximum file size provided")
+	ErrMinSizeAboveMaxSize     = errors.New("minimum file size cannot be larger than the maximum file size")
+	ErrInvalidCacheType        = errors.New("invalid cache type provided")
+	ErrCachePathWithoutSQLite  = errors.New("cache path cannot be set without cache type being sqlite")
+	ErrNoJournal               = errors.New("a journal path is required unless doing a dry run")
+	ErrNoBoltCachePath         = errors.New("bolt cache requires a cache path on disk")
 )
 
 func (c Config) Validate() error {
@@ -51,20 +142,47 @@ func (c Config) Validate() error {
 		return ErrBadLogLevel
 	}
 
-	if c.Source == "" {
+	if c.Mode != ModeTarget &&
+		c.Mode != ModeSelf {
+		return ErrInvalidMode
+	}
+
+	if len(c.Source) == 0 {
 		return ErrNoSource
 	}
 
-	if c.Target == "" {
+	if c.Mode == ModeSelf {
+		if len(c.Target) > 0 {
+			return ErrTargetInSelfMode
+		}
+
+		if c.Canonical != CanonicalOldest &&
+			c.Canonical != CanonicalShortestPath &&
+			c.Canonical != CanonicalLowestInode {
+			return ErrInvalidCanonical
+		}
+	} else if len(c.Target) == 0 {
 		return ErrNoTarget
 	}
 
-	if c.Source == c.Target {
-		return ErrSourceAndTargetSame
+	for _, target := range c.Target {
+		if target == "" {
+			return ErrNoTarget
+		}
 	}
 
-	if _, err := os.Stat(c.Source); errors.Is(err, os.ErrNotExist) {
-		return ErrSourceNotFound
+	for _, source := range c.Source {
+		if source == "" {
+			return ErrNoSource
+		}
+
+		if slices.Contains(c.Target, source) {
+			return ErrSourceAndTargetSame
+		}
+
+		if _, err := os.Stat(source); errors.Is(err, os.ErrNotExist) {
+			return ErrSourceNotFound
+		}
 	}
 
 	if c.BufferSize <= 0 {
@@ -75,8 +193,59 @@ func (c Config) Validate() error {
 		return ErrZeroHashJobs
 	}
 
+	if c.HashAlgorithm != HashAlgorithmBLAKE2b &&
+		c.HashAlgorithm != HashAlgorithmBLAKE3 &&
+		c.HashAlgorithm != HashAlgorithmSHA256 &&
+		c.HashAlgorithm != HashAlgorithmXXH3 {
+		return ErrInvalidHashAlgorithm
+	}
+
+	if c.PartialHashSize < 0 {
+		return ErrNegativePartialHashSize
+	}
+
+	if c.LinkMode != LinkModeHardlink &&
+		c.LinkMode != LinkModeReflink &&
+		c.LinkMode != LinkModeDedupeRange &&
+		c.LinkMode != LinkModeSymlink {
+		return ErrInvalidLinkMode
+	}
+
+	if (c.LinkMode == LinkModeSymlink || c.CrossDevice == CrossDeviceSymlink) &&
+		c.SymlinkStyle != SymlinkStyleRelative &&
+		c.SymlinkStyle != SymlinkStyleAbsolute {
+		return ErrInvalidSymlinkStyle
+	}
+
+	if c.CrossDevice != CrossDeviceSkip &&
+		c.CrossDevice != CrossDeviceSymlink &&
+		c.CrossDevice != CrossDeviceReflink {
+		return ErrInvalidCrossDevice
+	}
+
+	if c.Metadata != MetadataWarn &&
+		c.Metadata != MetadataSkip &&
+		c.Metadata != MetadataRefuse {
+		return ErrInvalidMetadata
+	}
+
+	minSize, err := utils.ParseSize(c.MinSize)
+	if err != nil {
+		return ErrInvalidMinSize
+	}
+
+	maxSize, err := utils.ParseSize(c.MaxSize)
+	if err != nil {
+		return ErrInvalidMaxSize
+	}
+
+	if maxSize > 0 && minSize > maxSize {
+		return ErrMinSizeAboveMaxSize
+	}
+
 	if c.CacheType != CacheTypeMemory &&
-		c.CacheType != CacheTypeSQLite {
+		c.CacheType != CacheTypeSQLite &&
+		c.CacheType != CacheTypeBolt {
 		return ErrInvalidCacheType
 	}
 
@@ -84,5 +253,13 @@ func (c Config) Validate() error {
 		return ErrCachePathWithoutSQLite
 	}
 
+	if c.CacheType == CacheTypeBolt && (c.CachePath == "" || c.CachePath == ":memory:") {
+		return ErrNoBoltCachePath
+	}
+
+	if c.Journal == "" && !c.DryRun {
+		return ErrNoJournal
+	}
+
 	return nil
 }
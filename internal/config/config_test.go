@@ -26,111 +26,471 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "valid config",
 			config: config.Config{
-				LogLevel:   config.LogLevelInfo,
-				Source:     tempDir,
-				Target:     filepath.Join(tempDir, "target"),
-				HashJobs:   4,
-				BufferSize: 1024,
-				CacheType:  config.CacheTypeMemory,
+				LogLevel:      config.LogLevelInfo,
+				Mode:          config.ModeTarget,
+				Source:        []string{tempDir},
+				Target:        []string{filepath.Join(tempDir, "target")},
+				HashJobs:      4,
+				BufferSize:    1024,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      config.LinkModeHardlink,
+				CrossDevice:   config.CrossDeviceSkip,
+				Metadata:      config.MetadataWarn,
+				Journal:       "relink-journal.jsonl",
 			},
 			wantErr: nil,
 		},
 		{
 			name: "invalid log level",
 			config: config.Config{
-				LogLevel:   "invalid",
-				Source:     tempDir,
-				Target:     filepath.Join(tempDir, "target"),
-				HashJobs:   4,
-				BufferSize: 1024,
-				CacheType:  config.CacheTypeMemory,
+				LogLevel:      "invalid",
+				Mode:          config.ModeTarget,
+				Source:        []string{tempDir},
+				Target:        []string{filepath.Join(tempDir, "target")},
+				HashJobs:      4,
+				BufferSize:    1024,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      config.LinkModeHardlink,
+				CrossDevice:   config.CrossDeviceSkip,
+				Metadata:      config.MetadataWarn,
+				Journal:       "relink-journal.jsonl",
 			},
 			wantErr: config.ErrBadLogLevel,
 		},
 		{
 			name: "missing source",
 			config: config.Config{
-				LogLevel:   config.LogLevelInfo,
-				Source:     "",
-				Target:     filepath.Join(tempDir, "target"),
-				HashJobs:   4,
-				BufferSize: 1024,
-				CacheType:  config.CacheTypeMemory,
+				LogLevel:      config.LogLevelInfo,
+				Mode:          config.ModeTarget,
+				Source:        []string{},
+				Target:        []string{filepath.Join(tempDir, "target")},
+				HashJobs:      4,
+				BufferSize:    1024,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      config.LinkModeHardlink,
+				CrossDevice:   config.CrossDeviceSkip,
+				Metadata:      config.MetadataWarn,
+				Journal:       "relink-journal.jsonl",
 			},
 			wantErr: config.ErrNoSource,
 		},
 		{
 			name: "missing target",
 			config: config.Config{
-				LogLevel:   config.LogLevelInfo,
-				Source:     tempDir,
-				Target:     "",
-				HashJobs:   4,
-				BufferSize: 1024,
-				CacheType:  config.CacheTypeMemory,
+				LogLevel:      config.LogLevelInfo,
+				Mode:          config.ModeTarget,
+				Source:        []string{tempDir},
+				Target:        []string{},
+				HashJobs:      4,
+				BufferSize:    1024,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      config.LinkModeHardlink,
+				CrossDevice:   config.CrossDeviceSkip,
+				Metadata:      config.MetadataWarn,
+				Journal:       "relink-journal.jsonl",
 			},
 			wantErr: config.ErrNoTarget,
 		},
 		{
 			name: "source and target same",
 			config: config.Config{
-				LogLevel:   config.LogLevelInfo,
-				Source:     tempDir,
-				Target:     tempDir,
-				HashJobs:   4,
-				BufferSize: 1024,
-				CacheType:  config.CacheTypeMemory,
+				LogLevel:      config.LogLevelInfo,
+				Mode:          config.ModeTarget,
+				Source:        []string{tempDir},
+				Target:        []string{tempDir},
+				HashJobs:      4,
+				BufferSize:    1024,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      config.LinkModeHardlink,
+				CrossDevice:   config.CrossDeviceSkip,
+				Metadata:      config.MetadataWarn,
+				Journal:       "relink-journal.jsonl",
 			},
 			wantErr: config.ErrSourceAndTargetSame,
 		},
 		{
 			name: "source directory not found",
 			config: config.Config{
-				LogLevel:   config.LogLevelInfo,
-				Source:     filepath.Join(tempDir, "non-existent"),
-				Target:     filepath.Join(tempDir, "target"),
-				HashJobs:   4,
-				BufferSize: 1024,
-				CacheType:  config.CacheTypeMemory,
+				LogLevel:      config.LogLevelInfo,
+				Mode:          config.ModeTarget,
+				Source:        []string{filepath.Join(tempDir, "non-existent")},
+				Target:        []string{filepath.Join(tempDir, "target")},
+				HashJobs:      4,
+				BufferSize:    1024,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      config.LinkModeHardlink,
+				CrossDevice:   config.CrossDeviceSkip,
+				Metadata:      config.MetadataWarn,
+				Journal:       "relink-journal.jsonl",
 			},
 			wantErr: config.ErrSourceNotFound,
 		},
 		{
 			name: "zero buffer size",
 			config: config.Config{
-				LogLevel:   config.LogLevelInfo,
-				Source:     tempDir,
-				Target:     filepath.Join(tempDir, "target"),
-				HashJobs:   4,
-				BufferSize: 0,
-				CacheType:  config.CacheTypeMemory,
+				LogLevel:      config.LogLevelInfo,
+				Mode:          config.ModeTarget,
+				Source:        []string{tempDir},
+				Target:        []string{filepath.Join(tempDir, "target")},
+				HashJobs:      4,
+				BufferSize:    0,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      config.LinkModeHardlink,
+				CrossDevice:   config.CrossDeviceSkip,
+				Metadata:      config.MetadataWarn,
+				Journal:       "relink-journal.jsonl",
 			},
 			wantErr: config.ErrZeroBufferSize,
 		},
 		{
 			name: "zero hash jobs",
 			config: config.Config{
-				LogLevel:   config.LogLevelInfo,
-				Source:     tempDir,
-				Target:     filepath.Join(tempDir, "target"),
-				HashJobs:   0,
-				BufferSize: 1024,
-				CacheType:  config.CacheTypeMemory,
+				LogLevel:      config.LogLevelInfo,
+				Mode:          config.ModeTarget,
+				Source:        []string{tempDir},
+				Target:        []string{filepath.Join(tempDir, "target")},
+				HashJobs:      0,
+				BufferSize:    1024,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      config.LinkModeHardlink,
+				CrossDevice:   config.CrossDeviceSkip,
+				Metadata:      config.MetadataWarn,
+				Journal:       "relink-journal.jsonl",
 			},
 			wantErr: config.ErrZeroHashJobs,
 		},
+		{
+			name: "negative partial hash size",
+			config: config.Config{
+				LogLevel:        config.LogLevelInfo,
+				Mode:            config.ModeTarget,
+				Source:          []string{tempDir},
+				Target:          []string{filepath.Join(tempDir, "target")},
+				HashJobs:        4,
+				BufferSize:      1024,
+				HashAlgorithm:   config.HashAlgorithmBLAKE2b,
+				PartialHashSize: -1,
+				CacheType:       config.CacheTypeMemory,
+				LinkMode:        config.LinkModeHardlink,
+				CrossDevice:     config.CrossDeviceSkip,
+				Metadata:        config.MetadataWarn,
+				Journal:         "relink-journal.jsonl",
+			},
+			wantErr: config.ErrNegativePartialHashSize,
+		},
+		{
+			name: "invalid hash algorithm",
+			config: config.Config{
+				LogLevel:      config.LogLevelInfo,
+				Mode:          config.ModeTarget,
+				Source:        []string{tempDir},
+				Target:        []string{filepath.Join(tempDir, "target")},
+				HashJobs:      4,
+				BufferSize:    1024,
+				HashAlgorithm: "md5",
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      config.LinkModeHardlink,
+				CrossDevice:   config.CrossDeviceSkip,
+				Metadata:      config.MetadataWarn,
+				Journal:       "relink-journal.jsonl",
+			},
+			wantErr: config.ErrInvalidHashAlgorithm,
+		},
+		{
+			name: "size limits with units",
+			config: config.Config{
+				LogLevel:      config.LogLevelInfo,
+				Mode:          config.ModeTarget,
+				Source:        []string{tempDir},
+				Target:        []string{filepath.Join(tempDir, "target")},
+				HashJobs:      4,
+				BufferSize:    1024,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      config.LinkModeHardlink,
+				CrossDevice:   config.CrossDeviceSkip,
+				Metadata:      config.MetadataWarn,
+				Journal:       "relink-journal.jsonl",
+				MinSize:       "4KiB",
+				MaxSize:       "1.5 GB",
+			},
+			wantErr: nil,
+		},
+		{
+			name: "invalid link mode",
+			config: config.Config{
+				LogLevel:      config.LogLevelInfo,
+				Mode:          config.ModeTarget,
+				Source:        []string{tempDir},
+				Target:        []string{filepath.Join(tempDir, "target")},
+				HashJobs:      4,
+				BufferSize:    1024,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      "copy",
+			},
+			wantErr: config.ErrInvalidLinkMode,
+		},
+		{
+			name: "invalid symlink style",
+			config: config.Config{
+				LogLevel:      config.LogLevelInfo,
+				Mode:          config.ModeTarget,
+				Source:        []string{tempDir},
+				Target:        []string{filepath.Join(tempDir, "target")},
+				HashJobs:      4,
+				BufferSize:    1024,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      config.LinkModeSymlink,
+				SymlinkStyle:  "canonical",
+			},
+			wantErr: config.ErrInvalidSymlinkStyle,
+		},
+		{
+			name: "invalid symlink style for the cross-device policy",
+			config: config.Config{
+				LogLevel:      config.LogLevelInfo,
+				Mode:          config.ModeTarget,
+				Source:        []string{tempDir},
+				Target:        []string{filepath.Join(tempDir, "target")},
+				HashJobs:      4,
+				BufferSize:    1024,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      config.LinkModeHardlink,
+				SymlinkStyle:  "canonical",
+				CrossDevice:   config.CrossDeviceSymlink,
+			},
+			wantErr: config.ErrInvalidSymlinkStyle,
+		},
+		{
+			name: "invalid cross-device policy",
+			config: config.Config{
+				LogLevel:      config.LogLevelInfo,
+				Mode:          config.ModeTarget,
+				Source:        []string{tempDir},
+				Target:        []string{filepath.Join(tempDir, "target")},
+				HashJobs:      4,
+				BufferSize:    1024,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      config.LinkModeHardlink,
+				CrossDevice:   "copy",
+			},
+			wantErr: config.ErrInvalidCrossDevice,
+		},
+		{
+			name: "no journal",
+			config: config.Config{
+				LogLevel:      config.LogLevelInfo,
+				Mode:          config.ModeTarget,
+				Source:        []string{tempDir},
+				Target:        []string{filepath.Join(tempDir, "target")},
+				HashJobs:      4,
+				BufferSize:    1024,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      config.LinkModeHardlink,
+				CrossDevice:   config.CrossDeviceSkip,
+				Metadata:      config.MetadataWarn,
+			},
+			wantErr: config.ErrNoJournal,
+		},
+		{
+			name: "dry run without journal",
+			config: config.Config{
+				LogLevel:      config.LogLevelInfo,
+				Mode:          config.ModeTarget,
+				Source:        []string{tempDir},
+				Target:        []string{filepath.Join(tempDir, "target")},
+				HashJobs:      4,
+				BufferSize:    1024,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      config.LinkModeHardlink,
+				CrossDevice:   config.CrossDeviceSkip,
+				Metadata:      config.MetadataWarn,
+				DryRun:        true,
+			},
+			wantErr: nil,
+		},
+		{
+			name: "invalid min size",
+			config: config.Config{
+				LogLevel:      config.LogLevelInfo,
+				Mode:          config.ModeTarget,
+				Source:        []string{tempDir},
+				Target:        []string{filepath.Join(tempDir, "target")},
+				HashJobs:      4,
+				BufferSize:    1024,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      config.LinkModeHardlink,
+				CrossDevice:   config.CrossDeviceSkip,
+				Metadata:      config.MetadataWarn,
+				Journal:       "relink-journal.jsonl",
+				MinSize:       "4 bananas",
+			},
+			wantErr: config.ErrInvalidMinSize,
+		},
+		{
+			name: "invalid max size",
+			config: config.Config{
+				LogLevel:      config.LogLevelInfo,
+				Mode:          config.ModeTarget,
+				Source:        []string{tempDir},
+				Target:        []string{filepath.Join(tempDir, "target")},
+				HashJobs:      4,
+				BufferSize:    1024,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      config.LinkModeHardlink,
+				CrossDevice:   config.CrossDeviceSkip,
+				Metadata:      config.MetadataWarn,
+				Journal:       "relink-journal.jsonl",
+				MaxSize:       "-1",
+			},
+			wantErr: config.ErrInvalidMaxSize,
+		},
+		{
+			name: "min size above max size",
+			config: config.Config{
+				LogLevel:      config.LogLevelInfo,
+				Mode:          config.ModeTarget,
+				Source:        []string{tempDir},
+				Target:        []string{filepath.Join(tempDir, "target")},
+				HashJobs:      4,
+				BufferSize:    1024,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      config.LinkModeHardlink,
+				CrossDevice:   config.CrossDeviceSkip,
+				Metadata:      config.MetadataWarn,
+				Journal:       "relink-journal.jsonl",
+				MinSize:       "2MiB",
+				MaxSize:       "1M",
+			},
+			wantErr: config.ErrMinSizeAboveMaxSize,
+		},
 		{
 			name: "invalid cache type",
 			config: config.Config{
-				LogLevel:   config.LogLevelInfo,
-				Source:     tempDir,
-				Target:     filepath.Join(tempDir, "target"),
-				HashJobs:   4,
-				BufferSize: 1024,
-				CacheType:  "invalid",
+				LogLevel:      config.LogLevelInfo,
+				Mode:          config.ModeTarget,
+				Source:        []string{tempDir},
+				Target:        []string{filepath.Join(tempDir, "target")},
+				HashJobs:      4,
+				BufferSize:    1024,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     "invalid",
+				LinkMode:      config.LinkModeHardlink,
+				CrossDevice:   config.CrossDeviceSkip,
+				Metadata:      config.MetadataWarn,
+				Journal:       "relink-journal.jsonl",
 			},
 			wantErr: config.ErrInvalidCacheType,
 		},
+		{
+			name: "bolt cache in memory",
+			config: config.Config{
+				LogLevel:      config.LogLevelInfo,
+				Mode:          config.ModeTarget,
+				Source:        []string{tempDir},
+				Target:        []string{filepath.Join(tempDir, "target")},
+				HashJobs:      4,
+				BufferSize:    1024,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeBolt,
+				LinkMode:      config.LinkModeHardlink,
+				CrossDevice:   config.CrossDeviceSkip,
+				Metadata:      config.MetadataWarn,
+				Journal:       "relink-journal.jsonl",
+				CachePath:     ":memory:",
+			},
+			wantErr: config.ErrNoBoltCachePath,
+		},
+		{
+			name: "invalid mode",
+			config: config.Config{
+				LogLevel:      config.LogLevelInfo,
+				Mode:          "invalid",
+				Source:        []string{tempDir},
+				Target:        []string{filepath.Join(tempDir, "target")},
+				HashJobs:      4,
+				BufferSize:    1024,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      config.LinkModeHardlink,
+				CrossDevice:   config.CrossDeviceSkip,
+				Metadata:      config.MetadataWarn,
+				Journal:       "relink-journal.jsonl",
+			},
+			wantErr: config.ErrInvalidMode,
+		},
+		{
+			name: "self mode without target",
+			config: config.Config{
+				LogLevel:      config.LogLevelInfo,
+				Mode:          config.ModeSelf,
+				Canonical:     config.CanonicalOldest,
+				Source:        []string{tempDir},
+				HashJobs:      4,
+				BufferSize:    1024,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      config.LinkModeHardlink,
+				CrossDevice:   config.CrossDeviceSkip,
+				Metadata:      config.MetadataWarn,
+				Journal:       "relink-journal.jsonl",
+			},
+			wantErr: nil,
+		},
+		{
+			name: "self mode with target",
+			config: config.Config{
+				LogLevel:      config.LogLevelInfo,
+				Mode:          config.ModeSelf,
+				Canonical:     config.CanonicalOldest,
+				Source:        []string{tempDir},
+				Target:        []string{filepath.Join(tempDir, "target")},
+				HashJobs:      4,
+				BufferSize:    1024,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      config.LinkModeHardlink,
+				CrossDevice:   config.CrossDeviceSkip,
+				Metadata:      config.MetadataWarn,
+				Journal:       "relink-journal.jsonl",
+			},
+			wantErr: config.ErrTargetInSelfMode,
+		},
+		{
+			name: "self mode with invalid canonical",
+			config: config.Config{
+				LogLevel:      config.LogLevelInfo,
+				Mode:          config.ModeSelf,
+				Canonical:     "invalid",
+				Source:        []string{tempDir},
+				HashJobs:      4,
+				BufferSize:    1024,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      config.LinkModeHardlink,
+				CrossDevice:   config.CrossDeviceSkip,
+				Metadata:      config.MetadataWarn,
+				Journal:       "relink-journal.jsonl",
+			},
+			wantErr: config.ErrInvalidCanonical,
+		},
 	}
 
 	for _, tt := range tests {
@@ -173,12 +533,18 @@ func TestLogLevelConstants(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := config.Config{
-				LogLevel:   tt.logLevel,
-				Source:     tempDir,
-				Target:     filepath.Join(tempDir, "target"),
-				BufferSize: 1024,
-				HashJobs:   4,
-				CacheType:  config.CacheTypeMemory,
+				LogLevel:      tt.logLevel,
+				Mode:          config.ModeTarget,
+				Source:        []string{tempDir},
+				Target:        []string{filepath.Join(tempDir, "target")},
+				BufferSize:    1024,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				HashJobs:      4,
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      config.LinkModeHardlink,
+				CrossDevice:   config.CrossDeviceSkip,
+				Metadata:      config.MetadataWarn,
+				Journal:       "relink-journal.jsonl",
 			}
 			err := cfg.Validate()
 			if tt.valid {
@@ -0,0 +1,149 @@
+package relink
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"syscall"
+
+	"github.com/USA-RedDragon/relink/internal/config"
+	"github.com/USA-RedDragon/relink/internal/utils"
+)
+
+func Apply(cfg *config.Config, plan *Plan) error {
+	var journal *Journal
+	if cfg.Journal != "" {
+		var err error
+		journal, err = OpenJournal(cfg.Journal)
+		if err != nil {
+			return err
+		}
+		defer journal.Close()
+	}
+
+	skipped := 0
+	mismatched := 0
+	crossDevice := 0
+	metadataSkipped := 0
+	applied := NewPlan(plan.Sources, plan.Targets, plan.HashAlgorithm)
+	for _, entry := range plan.Entries {
+		err := entry.Validate()
+		if errors.Is(err, ErrPlanEntryChanged) {
+			slog.Warn("skipping file that changed since planning", "source", entry.Source, "target", entry.Target, "error", err)
+			skipped++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if cfg.Verify {
+			same, err := CompareFiles(entry.Source, entry.Target, cfg.BufferSize)
+			if err != nil {
+				return fmt.Errorf("failed to verify %s: %w", entry.Target, err)
+			}
+			if !same {
+				slog.Warn("skipping file whose contents differ from the source despite matching hashes", "source", entry.Source, "target", entry.Target)
+				mismatched++
+				continue
+			}
+		}
+
+		mode := cfg.LinkMode
+		if entry.LinkMode != "" {
+			mode = entry.LinkMode
+		}
+
+		// Hardlinks and symlinks give the target the source's metadata.
+		// Reflinks keep the target's where they can and are checked once
+		// cloned, and dedupe keeps the target itself
+		if mode == config.LinkModeHardlink || mode == config.LinkModeSymlink {
+			differences, err := MetadataDifferences(entry.Source, entry.Target)
+			if err != nil {
+				return err
+			}
+			if len(differences) > 0 {
+				err = checkMetadata(cfg.Metadata, entry.Source, entry.Target, differences)
+				if errors.Is(err, errMetadataSkipped) {
+					metadataSkipped++
+					continue
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if journal != nil {
+			journalEntry, err := NewJournalEntry(entry.Source, entry.Target, entry.Hash, plan.HashAlgorithm)
+			if err != nil {
+				return err
+			}
+			err = journal.Record(journalEntry)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = Link(cfg, mode, entry.Source, entry.Target)
+		// Hardlinks can't span mount points either, even of the same
+		// filesystem, which planning can't tell apart by device
+		if mode == config.LinkModeHardlink && errors.Is(err, syscall.EXDEV) {
+			switch cfg.CrossDevice {
+			case config.CrossDeviceSymlink:
+				mode = config.LinkModeSymlink
+			case config.CrossDeviceReflink:
+				mode = config.LinkModeReflink
+			case config.CrossDeviceSkip:
+				fallthrough
+			default:
+				slog.Warn("skipping file on a different device than its source", "source", entry.Source, "target", entry.Target)
+				crossDevice++
+				continue
+			}
+			entry.LinkMode = mode
+			err = Link(cfg, mode, entry.Source, entry.Target)
+		}
+		// Reflinks are checked against the metadata policy once cloned
+		if errors.Is(err, errMetadataSkipped) {
+			metadataSkipped++
+			continue
+		}
+		if errors.Is(err, ErrDedupeRangeDiffers) {
+			slog.Warn("skipping file whose contents no longer match the source", "source", entry.Source, "target", entry.Target)
+			skipped++
+			continue
+		}
+		// Cross-device reflinks are only attempted in case the filesystem
+		// supports them
+		if entry.LinkMode == config.LinkModeReflink && errors.Is(err, ErrReflinkNotSupported) {
+			slog.Warn("skipping file on a different device than its source that could not be reflinked", "source", entry.Source, "target", entry.Target, "error", err)
+			crossDevice++
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to replace target: %w", err)
+		}
+		slog.Info("file hashes match, target replaced", "source", entry.Source, "target", entry.Target, "linkMode", mode)
+		applied.Add(entry)
+	}
+
+	for _, stats := range applied.TargetStats() {
+		slog.Info("Target relinked", "target", stats.Target, "files", stats.Files, "reclaimed", utils.HumanReadableSize(stats.Bytes))
+	}
+
+	if skipped > 0 {
+		slog.Warn("some files were skipped because they changed since planning", "skipped", skipped)
+	}
+	if mismatched > 0 {
+		slog.Warn("some files were skipped because verification failed", "skipped", mismatched)
+	}
+	if metadataSkipped > 0 {
+		slog.Warn("some files were skipped because their metadata would not be preserved", "skipped", metadataSkipped)
+	}
+	if crossDevice > 0 {
+		slog.Warn("some files were skipped because they are on a different device than their source", "skipped", crossDevice)
+	}
+
+	return nil
+}
@@ -4,8 +4,29 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"github.com/USA-RedDragon/relink/internal/config"
 )
 
+// Link replaces target with source using the given link mode. Reflinks that
+// can't preserve the target's metadata are subject to the metadata policy.
+func Link(cfg *config.Config, mode config.LinkMode, source, target string) error {
+	switch mode {
+	case config.LinkModeReflink:
+		return AtomicReflink(source, target, func(differences []string) error {
+			return checkMetadata(cfg.Metadata, source, target, differences)
+		})
+	case config.LinkModeDedupeRange:
+		return DedupeRange(source, target)
+	case config.LinkModeSymlink:
+		return AtomicSymlink(source, target, cfg.SymlinkStyle != config.SymlinkStyleAbsolute)
+	case config.LinkModeHardlink:
+		fallthrough
+	default:
+		return AtomicLink(source, target)
+	}
+}
+
 func AtomicLink(source, target string) error {
 	tempName, err := GetSafeTempFile(filepath.Dir(target), ".relink-"+filepath.Base(target))
 	if err != nil {
@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+)
+
+// maxBatchSize caps how many queued writes are committed in one transaction.
+const maxBatchSize = 1000
+
+// batcher queues writes for a dedicated writer goroutine, which commits
+// whatever queued up while the previous batch was being committed as a single
+// transaction.
+type batcher struct {
+	commit func(batch []write) error
+	writes chan write
+	done   chan struct{}
+
+	// mu guards pending, which holds entries that have been queued but not
+	// yet committed so reads never miss a write, and err, the first write
+	// error, which is returned from every later write.
+	mu      sync.Mutex
+	pending map[string]pendingEntry
+	seq     uint64
+	err     error
+}
+
+type pendingEntry struct {
+	Entry
+	seq     uint64
+	deleted bool
+}
+
+// write is either an entry to store or delete, or, when flushed is set, a
+// request to be told once everything queued before it has been committed.
+// Flush requests are never passed to commit.
+type write struct {
+	key     string
+	entry   Entry
+	seq     uint64
+	deleted bool
+	flushed chan error
+}
+
+func newBatcher(commit func(batch []write) error) *batcher {
+	b := &batcher{
+		commit:  commit,
+		writes:  make(chan write, maxBatchSize),
+		done:    make(chan struct{}),
+		pending: make(map[string]pendingEntry),
+	}
+	go b.run()
+	return b
+}
+
+// queue hands a write to the writer goroutine. Errors from earlier writes are
+// returned by the next queue, flush or close.
+func (b *batcher) queue(w write) error {
+	b.mu.Lock()
+	if b.err != nil {
+		b.mu.Unlock()
+		return b.err
+	}
+	b.seq++
+	w.seq = b.seq
+	b.pending[w.key] = pendingEntry{Entry: w.entry, seq: w.seq, deleted: w.deleted}
+	b.mu.Unlock()
+
+	b.writes <- w
+	return nil
+}
+
+// get returns the newest queued write for the key, if it hasn't been
+// committed yet.
+func (b *batcher) get(key string) (pendingEntry, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	pending, ok := b.pending[key]
+	return pending, ok
+}
+
+// flush blocks until every queued write has been committed.
+func (b *batcher) flush() error {
+	b.mu.Lock()
+	empty, err := len(b.pending) == 0, b.err
+	b.mu.Unlock()
+	if empty {
+		return err
+	}
+
+	flushed := make(chan error, 1)
+	b.writes <- write{flushed: flushed}
+	return <-flushed
+}
+
+// close commits any queued writes and stops the writer goroutine.
+func (b *batcher) close() error {
+	close(b.writes)
+	<-b.done
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+func (b *batcher) run() {
+	defer close(b.done)
+	for w := range b.writes {
+		batch := []write{w}
+		// Take whatever else queued up while the last batch was committing
+	collect:
+		for len(batch) < maxBatchSize {
+			select {
+			case w, ok := <-b.writes:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, w)
+			default:
+				break collect
+			}
+		}
+		b.apply(batch)
+	}
+}
+
+func (b *batcher) apply(batch []write) {
+	writes := make([]write, 0, len(batch))
+	for _, w := range batch {
+		if w.flushed == nil {
+			writes = append(writes, w)
+		}
+	}
+	var err error
+	if len(writes) > 0 {
+		err = b.commit(writes)
+	}
+
+	b.mu.Lock()
+	for _, w := range writes {
+		// A newer write for the same key is still queued
+		if pending, ok := b.pending[w.key]; ok && pending.seq == w.seq {
+			delete(b.pending, w.key)
+		}
+	}
+	if err != nil && b.err == nil {
+		b.err = fmt.Errorf("failed to write to cache: %w", err)
+	}
+	err = b.err
+	b.mu.Unlock()
+
+	for _, w := range batch {
+		if w.flushed != nil {
+			w.flushed <- err
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+var errCommit = errors.New("commit failed")
+
+// blockingCommit is a commit func that reports each batch it is given on
+// started, then waits for release before returning.
+type blockingCommit struct {
+	started chan []write
+	release chan struct{}
+}
+
+func newBlockingCommit() *blockingCommit {
+	return &blockingCommit{
+		started: make(chan []write, maxBatchSize),
+		release: make(chan struct{}),
+	}
+}
+
+func (c *blockingCommit) commit(batch []write) error {
+	c.started <- batch
+	<-c.release
+	return nil
+}
+
+func TestBatcherGetSeesQueuedWrite(t *testing.T) {
+	t.Parallel()
+	commit := newBlockingCommit()
+	b := newBatcher(commit.commit)
+
+	if err := b.queue(write{key: "a", entry: Entry{Hash: []byte{1}}}); err != nil {
+		t.Fatalf("queue failed: %v", err)
+	}
+	<-commit.started
+
+	pending, ok := b.get("a")
+	if !ok || pending.deleted || !bytes.Equal(pending.Hash, []byte{1}) {
+		t.Errorf("get(a) = %+v, %v, want the queued entry", pending, ok)
+	}
+
+	close(commit.release)
+	if err := b.close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if _, ok := b.get("a"); ok {
+		t.Error("Expected the committed write to no longer be pending")
+	}
+}
+
+func TestBatcherOlderCommitKeepsNewerWrite(t *testing.T) {
+	t.Parallel()
+	commit := newBlockingCommit()
+	b := newBatcher(commit.commit)
+
+	if err := b.queue(write{key: "a", entry: Entry{Hash: []byte{1}}}); err != nil {
+		t.Fatalf("queue failed: %v", err)
+	}
+	<-commit.started
+	if err := b.queue(write{key: "a", entry: Entry{Hash: []byte{2}}}); err != nil {
+		t.Fatalf("queue failed: %v", err)
+	}
+
+	// Let the first commit finish, then hold the second one open
+	commit.release <- struct{}{}
+	<-commit.started
+	pending, ok := b.get("a")
+	if !ok || !bytes.Equal(pending.Hash, []byte{2}) {
+		t.Errorf("get(a) = %+v, %v, want the newer queued entry", pending, ok)
+	}
+
+	close(commit.release)
+	if err := b.close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+}
+
+func TestBatcherCommitErrorIsSticky(t *testing.T) {
+	t.Parallel()
+	b := newBatcher(func([]write) error { return errCommit })
+
+	if err := b.queue(write{key: "a"}); err != nil {
+		t.Fatalf("queue failed: %v", err)
+	}
+	if err := b.flush(); !errors.Is(err, errCommit) {
+		t.Errorf("flush() error = %v, want %v", err, errCommit)
+	}
+	if err := b.queue(write{key: "b"}); !errors.Is(err, errCommit) {
+		t.Errorf("queue() error = %v, want %v", err, errCommit)
+	}
+	if err := b.flush(); !errors.Is(err, errCommit) {
+		t.Errorf("flush() error = %v, want %v", err, errCommit)
+	}
+	if err := b.close(); !errors.Is(err, errCommit) {
+		t.Errorf("close() error = %v, want %v", err, errCommit)
+	}
+}
+
+func TestBatcherCloseCommitsQueuedWrites(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	committed := []string{}
+	b := newBatcher(func(batch []write) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, w := range batch {
+			committed = append(committed, w.key)
+		}
+		return nil
+	})
+
+	keys := []string{"a", "b", "c"}
+	for _, key := range keys {
+		if err := b.queue(write{key: key}); err != nil {
+			t.Fatalf("queue failed: %v", err)
+		}
+	}
+	if err := b.close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(committed, keys) {
+		t.Errorf("Committed %v, want %v", committed, keys)
+	}
+}
+
+func TestCacheLookupsSeeQueuedWrites(t *testing.T) {
+	t.Parallel()
+
+	sqliteCache, err := NewSQLiteCache(":memory:")
+	if err != nil {
+		t.Fatalf("NewSQLiteCache failed: %v", err)
+	}
+	boltCache, err := NewBoltCache(filepath.Join(t.TempDir(), "cache.bolt"))
+	if err != nil {
+		t.Fatalf("NewBoltCache failed: %v", err)
+	}
+
+	for name, cc := range map[string]Cache{"sqlite": sqliteCache, "bolt": boltCache} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			defer cc.Close()
+
+			if err := cc.Put("a", Entry{Partial: []byte{1}, Hash: []byte{2}}); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+			keys, err := cc.GetByPartialHash([]byte{1})
+			if err != nil {
+				t.Fatalf("GetByPartialHash failed: %v", err)
+			}
+			if !slices.Equal(keys, []string{"a"}) {
+				t.Errorf("GetByPartialHash() = %v, want [a]", keys)
+			}
+			keys, err = cc.GetByHash([]byte{2})
+			if err != nil {
+				t.Fatalf("GetByHash failed: %v", err)
+			}
+			if !slices.Equal(keys, []string{"a"}) {
+				t.Errorf("GetByHash() = %v, want [a]", keys)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// The entries bucket maps keys to their JSON encoded entry. The hashes and
+// partials buckets hold a nested bucket per hash, whose keys are the keys of
+// every entry with that hash.
+const (
+	entriesBucket  = "entries"
+	hashesBucket   = "hashes"
+	partialsBucket = "partials"
+)
+
+type BoltCache struct {
+	db     *bolt.DB
+	writer *batcher
+}
+
+func NewBoltCache(path string) (*BoltCache, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{entriesBucket, hashesBucket, partialsBucket} {
+			_, err := tx.CreateBucketIfNotExists([]byte(name))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	b := &BoltCache{
+		db: db,
+	}
+	b.writer = newBatcher(b.commit)
+	return b, nil
+}
+
+// Put queues the entry to be written by the writer goroutine. Errors from
+// earlier writes are returned by the next Put, Delete or Close.
+func (b *BoltCache) Put(key string, entry Entry) error {
+	return b.writer.queue(write{key: key, entry: entry})
+}
+
+func (b *BoltCache) Delete(key string) error {
+	return b.writer.queue(write{key: key, deleted: true})
+}
+
+func (b *BoltCache) commit(batch []write) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		for _, w := range batch {
+			err := remove(tx, w.key)
+			if err != nil {
+				return err
+			}
+			if w.deleted {
+				continue
+			}
+			value, err := json.Marshal(w.entry)
+			if err != nil {
+				return err
+			}
+			err = tx.Bucket([]byte(entriesBucket)).Put([]byte(w.key), value)
+			if err != nil {
+				return err
+			}
+			err = index(tx.Bucket([]byte(hashesBucket)), w.entry.Hash, w.key)
+			if err != nil {
+				return err
+			}
+			err = index(tx.Bucket([]byte(partialsBucket)), w.entry.Partial, w.key)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *BoltCache) Get(key string) (Entry, bool, error) {
+	if pending, ok := b.writer.get(key); ok {
+		return pending.Entry, !pending.deleted, nil
+	}
+
+	var entry Entry
+	var ok bool
+	err := b.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket([]byte(entriesBucket)).Get([]byte(key))
+		if value == nil {
+			return nil
+		}
+		ok = true
+		return json.Unmarshal(value, &entry)
+	})
+	if err != nil {
+		return Entry{}, false, err
+	}
+	return entry, ok, nil
+}
+
+func (b *BoltCache) GetByHash(hash []byte) ([]string, error) {
+	return b.lookup(hashesBucket, hash)
+}
+
+func (b *BoltCache) GetByPartialHash(partial []byte) ([]string, error) {
+	return b.lookup(partialsBucket, partial)
+}
+
+// lookup returns the keys indexed under a hash in one of the hash buckets.
+func (b *BoltCache) lookup(name string, hash []byte) ([]string, error) {
+	err := b.writer.flush()
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	err = b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(name)).Bucket(hash)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, _ []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+	})
+	return keys, err
+}
+
+func (b *BoltCache) Range(fn func(key string, entry Entry) error) error {
+	err := b.writer.flush()
+	if err != nil {
+		return err
+	}
+	return b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(entriesBucket)).ForEach(func(k, value []byte) error {
+			var entry Entry
+			err := json.Unmarshal(value, &entry)
+			if err != nil {
+				return err
+			}
+			return fn(string(k), entry)
+		})
+	})
+}
+
+// Vacuum compacts the database into a new file and swaps it into place. It
+// must not be called while the cache is in use.
+func (b *BoltCache) Vacuum() error {
+	err := b.writer.flush()
+	if err != nil {
+		return err
+	}
+	path := b.db.Path()
+	compactPath := path + ".compact"
+	compacted, err := bolt.Open(compactPath, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return fmt.Errorf("failed to create compacted cache: %w", err)
+	}
+	err = bolt.Compact(compacted, b.db, 0)
+	if closeErr := compacted.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(compactPath)
+		return fmt.Errorf("failed to compact cache: %w", err)
+	}
+
+	err = b.db.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(compactPath, path)
+	if err != nil {
+		return fmt.Errorf("failed to replace cache: %w", err)
+	}
+	b.db, err = bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	return err
+}
+
+// Close commits any queued writes before closing the database.
+func (b *BoltCache) Close() error {
+	return errors.Join(b.writer.close(), b.db.Close())
+}
+
+// remove deletes an entry and its keys in the hash buckets, if it exists.
+func remove(tx *bolt.Tx, key string) error {
+	entries := tx.Bucket([]byte(entriesBucket))
+	value := entries.Get([]byte(key))
+	if value == nil {
+		return nil
+	}
+	var entry Entry
+	err := json.Unmarshal(value, &entry)
+	if err != nil {
+		return err
+	}
+	err = unindex(tx.Bucket([]byte(hashesBucket)), entry.Hash, key)
+	if err != nil {
+		return err
+	}
+	err = unindex(tx.Bucket([]byte(partialsBucket)), entry.Partial, key)
+	if err != nil {
+		return err
+	}
+	return entries.Delete([]byte(key))
+}
+
+func index(bucket *bolt.Bucket, hash []byte, key string) error {
+	if len(hash) == 0 {
+		return nil
+	}
+	keys, err := bucket.CreateBucketIfNotExists(hash)
+	if err != nil {
+		return err
+	}
+	return keys.Put([]byte(key), []byte{})
+}
+
+func unindex(bucket *bolt.Bucket, hash []byte, key string) error {
+	if len(hash) == 0 {
+		return nil
+	}
+	keys := bucket.Bucket(hash)
+	if keys == nil {
+		return nil
+	}
+	err := keys.Delete([]byte(key))
+	if err != nil {
+		return err
+	}
+	if k, _ := keys.Cursor().First(); k == nil {
+		return bucket.DeleteBucket(hash)
+	}
+	return nil
+}
@@ -1,8 +1,49 @@
 package cache
 
+import "time"
+
+// Metadata identifies the version of a file a hash was computed from. A
+// cached hash is only trusted while the file's metadata is unchanged.
+type Metadata struct {
+	Size       int64
+	ModTime    time.Time
+	ChangeTime time.Time
+	Inode      uint64
+	Device     uint64
+}
+
+func (m Metadata) Equal(other Metadata) bool {
+	return m.Size == other.Size &&
+		m.ModTime.Equal(other.ModTime) &&
+		m.ChangeTime.Equal(other.ChangeTime) &&
+		m.Inode == other.Inode &&
+		m.Device == other.Device
+}
+
+type Entry struct {
+	Metadata
+
+	// Algorithm is the hash algorithm both hashes were computed with.
+	Algorithm string
+	// PartialSize is the size of the blocks the partial hash was computed from.
+	PartialSize int
+	// Partial is the digest of the file's size and the blocks at its start
+	// and end. For files small enough to be read in full, it is the full hash.
+	Partial []byte
+	// Hash is the full hash of the file, or nil if it has not been computed.
+	Hash []byte
+}
+
 type Cache interface {
-	Put(key string, value []byte) error
-	GetByHash(hash []byte) (string, error)
-	Exists(key string) (bool, error)
+	Put(key string, entry Entry) error
+	Get(key string) (Entry, bool, error)
+	GetByHash(hash []byte) ([]string, error)
+	GetByPartialHash(partial []byte) ([]string, error)
+	Delete(key string) error
+	// Range calls fn for every entry until fn returns an error. fn must not
+	// call back into the cache.
+	Range(fn func(key string, entry Entry) error) error
+	// Vacuum reclaims the space left behind by deleted entries.
+	Vacuum() error
 	Close() error
 }
@@ -1,47 +1,120 @@
 package cache
 
 import (
-	"slices"
+	"sync"
 
 	"github.com/puzpuzpuz/xsync/v4"
 )
 
 type MemoryCache struct {
-	cache *xsync.Map[string, []byte]
+	cache *xsync.Map[string, Entry]
+
+	// indexMutex guards the reverse indexes, which map a hash or partial
+	// hash to the set of keys whose entry has it.
+	indexMutex sync.RWMutex
+	byHash     map[string]map[string]struct{}
+	byPartial  map[string]map[string]struct{}
 }
 
 func NewMemoryCache() *MemoryCache {
 	return &MemoryCache{
-		cache: xsync.NewMap[string, []byte](),
+		cache:     xsync.NewMap[string, Entry](),
+		byHash:    make(map[string]map[string]struct{}),
+		byPartial: make(map[string]map[string]struct{}),
 	}
 }
 
-func (m *MemoryCache) Put(key string, value []byte) error {
-	m.cache.Store(key, value)
+func (m *MemoryCache) Put(key string, entry Entry) error {
+	m.indexMutex.Lock()
+	defer m.indexMutex.Unlock()
+
+	old, loaded := m.cache.LoadAndStore(key, entry)
+	if loaded {
+		removeIndex(m.byHash, old.Hash, key)
+		removeIndex(m.byPartial, old.Partial, key)
+	}
+	addIndex(m.byHash, entry.Hash, key)
+	addIndex(m.byPartial, entry.Partial, key)
 	return nil
 }
 
-func (m *MemoryCache) GetByHash(hash []byte) (string, error) {
-	var foundKey string
-	m.cache.Range(func(key string, value []byte) bool {
-		if slices.Equal(value, hash) {
-			foundKey = key
-			return false // Stop iteration
-		}
-		return true // Continue iteration
-	})
-	if foundKey == "" {
-		return "", nil // Not found
+func (m *MemoryCache) Get(key string) (Entry, bool, error) {
+	entry, ok := m.cache.Load(key)
+	return entry, ok, nil
+}
+
+func (m *MemoryCache) GetByHash(hash []byte) ([]string, error) {
+	m.indexMutex.RLock()
+	defer m.indexMutex.RUnlock()
+
+	keys := make([]string, 0, len(m.byHash[string(hash)]))
+	for key := range m.byHash[string(hash)] {
+		keys = append(keys, key)
 	}
-	return foundKey, nil
+	return keys, nil
 }
 
-func (m *MemoryCache) Exists(key string) (bool, error) {
-	_, ok := m.cache.Load(key)
-	return ok, nil
+func (m *MemoryCache) GetByPartialHash(partial []byte) ([]string, error) {
+	m.indexMutex.RLock()
+	defer m.indexMutex.RUnlock()
+
+	keys := make([]string, 0, len(m.byPartial[string(partial)]))
+	for key := range m.byPartial[string(partial)] {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (m *MemoryCache) Delete(key string) error {
+	m.indexMutex.Lock()
+	defer m.indexMutex.Unlock()
+
+	old, loaded := m.cache.LoadAndDelete(key)
+	if loaded {
+		removeIndex(m.byHash, old.Hash, key)
+		removeIndex(m.byPartial, old.Partial, key)
+	}
+	return nil
+}
+
+func (m *MemoryCache) Range(fn func(key string, entry Entry) error) error {
+	var err error
+	m.cache.Range(func(key string, entry Entry) bool {
+		err = fn(key, entry)
+		return err == nil
+	})
+	return err
+}
+
+func (m *MemoryCache) Vacuum() error {
+	// No-op for memory cache
+	return nil
 }
 
 func (m *MemoryCache) Close() error {
 	// No-op for memory cache
 	return nil
 }
+
+func addIndex(index map[string]map[string]struct{}, hash []byte, key string) {
+	if hash == nil {
+		return
+	}
+	keys, ok := index[string(hash)]
+	if !ok {
+		keys = make(map[string]struct{})
+		index[string(hash)] = keys
+	}
+	keys[key] = struct{}{}
+}
+
+func removeIndex(index map[string]map[string]struct{}, hash []byte, key string) {
+	if hash == nil {
+		return
+	}
+	keys := index[string(hash)]
+	delete(keys, key)
+	if len(keys) == 0 {
+		delete(index, string(hash))
+	}
+}
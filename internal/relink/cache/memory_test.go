@@ -0,0 +1,73 @@
+package cache_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/USA-RedDragon/relink/internal/relink/cache"
+)
+
+func assertKeys(t *testing.T, lookup func([]byte) ([]string, error), hash []byte, want ...string) {
+	t.Helper()
+	keys, err := lookup(hash)
+	if err != nil {
+		t.Fatalf("Lookup of %x failed: %v", hash, err)
+	}
+	slices.Sort(keys)
+	if !slices.Equal(keys, want) {
+		t.Errorf("Lookup of %x = %v, want %v", hash, keys, want)
+	}
+}
+
+func TestMemoryCacheIndexes(t *testing.T) {
+	t.Parallel()
+
+	t.Run("overwriting an entry moves it to its new hashes", func(t *testing.T) {
+		t.Parallel()
+		cc := cache.NewMemoryCache()
+		if err := cc.Put("a", cache.Entry{Partial: []byte{1}, Hash: []byte{1}}); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		if err := cc.Put("a", cache.Entry{Partial: []byte{2}, Hash: []byte{2}}); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+
+		assertKeys(t, cc.GetByHash, []byte{1})
+		assertKeys(t, cc.GetByPartialHash, []byte{1})
+		assertKeys(t, cc.GetByHash, []byte{2}, "a")
+		assertKeys(t, cc.GetByPartialHash, []byte{2}, "a")
+	})
+
+	t.Run("deleting an entry removes it from both indexes", func(t *testing.T) {
+		t.Parallel()
+		cc := cache.NewMemoryCache()
+		if err := cc.Put("a", cache.Entry{Partial: []byte{1}, Hash: []byte{2}}); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		if err := cc.Delete("a"); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+
+		assertKeys(t, cc.GetByPartialHash, []byte{1})
+		assertKeys(t, cc.GetByHash, []byte{2})
+		if _, ok, _ := cc.Get("a"); ok {
+			t.Error("Expected a to be deleted")
+		}
+	})
+
+	t.Run("keys sharing a hash are all indexed", func(t *testing.T) {
+		t.Parallel()
+		cc := cache.NewMemoryCache()
+		for _, key := range []string{"a", "b", "c"} {
+			if err := cc.Put(key, cache.Entry{Partial: []byte{1}, Hash: []byte{2}}); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+		}
+		if err := cc.Delete("b"); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+
+		assertKeys(t, cc.GetByPartialHash, []byte{1}, "a", "c")
+		assertKeys(t, cc.GetByHash, []byte{2}, "a", "c")
+	})
+}
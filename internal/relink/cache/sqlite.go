@@ -2,68 +2,287 @@ package cache
 
 import (
 	"database/sql"
-	"sync"
+	"errors"
+	"fmt"
+	"time"
 
 	_ "github.com/glebarez/go-sqlite"
 )
 
+var ErrUnsupportedSchemaVersion = errors.New("cache was created by a newer version of relink")
+
 type SQLiteCache struct {
-	db         *sql.DB
-	writeMutex sync.Mutex
+	db     *sql.DB
+	writer *batcher
 }
 
 func NewSQLiteCache(path string) (*SQLiteCache, error) {
-	db, err := sql.Open("sqlite", path)
+	db, err := sql.Open("sqlite", path+"?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(5000)")
 	if err != nil {
 		return nil, err
 	}
+	if path == ":memory:" {
+		// Every connection to :memory: gets its own empty database
+		db.SetMaxOpenConns(1)
+	}
 	err = migrate(db)
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
-	return &SQLiteCache{
+	s := &SQLiteCache{
 		db: db,
-	}, nil
+	}
+	s.writer = newBatcher(s.commit)
+	return s, nil
+}
+
+// migrations upgrade the schema one version at a time. The schema version is
+// tracked in PRAGMA user_version, so a migration's position in this list is
+// its version and existing migrations must never be reordered or changed.
+func migrations() []func(tx *sql.Tx) error {
+	return []func(tx *sql.Tx) error{
+		// 1: the original cache table.
+		func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+			CREATE TABLE IF NOT EXISTS cache (
+				key TEXT PRIMARY KEY,
+				value BLOB
+			);
+			`)
+			return err
+		},
+		// 2: partial hashes, the hash algorithm and file metadata. Caches from
+		// before versioned migrations may already have some of these columns.
+		func(tx *sql.Tx) error {
+			for _, column := range []struct{ name, typ string }{
+				{"partial", "BLOB"},
+				{"algorithm", "TEXT"},
+				{"size", "INTEGER"},
+				{"mtime", "INTEGER"},
+				{"ctime", "INTEGER"},
+				{"inode", "INTEGER"},
+				{"device", "INTEGER"},
+			} {
+				err := addColumn(tx, "cache", column.name, column.typ)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		// 3: indexes for looking entries up by hash and partial hash.
+		func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+			CREATE INDEX IF NOT EXISTS cache_value ON cache (value);
+			CREATE INDEX IF NOT EXISTS cache_partial ON cache (partial);
+			`)
+			return err
+		},
+		// 4: the block size of the partial hash.
+		func(tx *sql.Tx) error {
+			return addColumn(tx, "cache", "partial_size", "INTEGER")
+		},
+	}
 }
 
 func migrate(db *sql.DB) error {
-	_, err := db.Exec(`
-	CREATE TABLE IF NOT EXISTS cache (
-		key TEXT PRIMARY KEY,
-		value BLOB
-	);
-	`)
-	return err
+	var version int
+	err := db.QueryRow("PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+	steps := migrations()
+	if version > len(steps) {
+		return fmt.Errorf("%w: %d", ErrUnsupportedSchemaVersion, version)
+	}
+
+	for ; version < len(steps); version++ {
+		err := migrateTo(db, steps[version], version+1)
+		if err != nil {
+			return fmt.Errorf("failed to migrate cache to schema version %d: %w", version+1, err)
+		}
+	}
+	return nil
 }
 
-func (s *SQLiteCache) Put(key string, value []byte) error {
-	s.writeMutex.Lock()
-	defer s.writeMutex.Unlock()
-	_, err := s.db.Exec("INSERT OR REPLACE INTO cache (key, value) VALUES (?, ?)", key, value)
+// migrateTo applies a single migration, bumping the schema version in the
+// same transaction so an interrupted upgrade is retried from the start.
+func migrateTo(db *sql.DB, step func(tx *sql.Tx) error, version int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	err = step(tx)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func addColumn(tx *sql.Tx, table, column, typ string) error {
+	var exists bool
+	err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM pragma_table_info(?) WHERE name = ?)", table, column).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	_, err = tx.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + typ)
 	return err
 }
 
-func (s *SQLiteCache) GetByHash(hash []byte) (string, error) {
-	var key string
-	err := s.db.QueryRow("SELECT key FROM cache WHERE value = ? LIMIT 1", hash).Scan(&key)
+// Put queues the entry to be written by the writer goroutine. Errors from
+// earlier writes are returned by the next Put, Delete or Close.
+func (s *SQLiteCache) Put(key string, entry Entry) error {
+	return s.writer.queue(write{key: key, entry: entry})
+}
+
+func (s *SQLiteCache) Delete(key string) error {
+	return s.writer.queue(write{key: key, deleted: true})
+}
+
+func (s *SQLiteCache) commit(batch []write) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	stmt, err := tx.Prepare("INSERT OR REPLACE INTO cache (key, value, partial, algorithm, partial_size, size, mtime, ctime, inode, device) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, w := range batch {
+		if w.deleted {
+			_, err = tx.Exec("DELETE FROM cache WHERE key = ?", w.key)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		// SQLite integers are signed, so the inode and device are stored as
+		// their two's complement to survive values with the high bit set.
+		_, err = stmt.Exec(
+			w.key, w.entry.Hash, w.entry.Partial, w.entry.Algorithm, w.entry.PartialSize,
+			w.entry.Size, w.entry.ModTime.UnixNano(), w.entry.ChangeTime.UnixNano(), int64(w.entry.Inode), int64(w.entry.Device),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteCache) Get(key string) (Entry, bool, error) {
+	if pending, ok := s.writer.get(key); ok {
+		return pending.Entry, !pending.deleted, nil
+	}
+
+	entry, err := scanEntry(s.db.QueryRow("SELECT value, partial, algorithm, partial_size, size, mtime, ctime, inode, device FROM cache WHERE key = ?", key))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return "", nil
+			return Entry{}, false, nil
 		}
-		return "", err
+		return Entry{}, false, err
 	}
-	return key, nil
+	return entry, true, nil
 }
 
-func (s *SQLiteCache) Exists(key string) (bool, error) {
-	var exists bool
-	err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM cache WHERE key = ?)", key).Scan(&exists)
+func (s *SQLiteCache) Range(fn func(key string, entry Entry) error) error {
+	err := s.writer.flush()
 	if err != nil {
-		return false, err
+		return err
+	}
+	rows, err := s.db.Query("SELECT key, value, partial, algorithm, partial_size, size, mtime, ctime, inode, device FROM cache")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		entry, err := scanEntry(rows, &key)
+		if err != nil {
+			return err
+		}
+		err = fn(key, entry)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *SQLiteCache) Vacuum() error {
+	err := s.writer.flush()
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec("VACUUM")
+	return err
+}
+
+// scanEntry scans any leading columns into dest, followed by the entry's
+// columns in table order.
+func scanEntry(row interface{ Scan(dest ...any) error }, dest ...any) (Entry, error) {
+	var entry Entry
+	var algorithm sql.NullString
+	var partialSize, size, mtime, ctime, inode, device sql.NullInt64
+	err := row.Scan(append(dest, &entry.Hash, &entry.Partial, &algorithm, &partialSize, &size, &mtime, &ctime, &inode, &device)...)
+	if err != nil {
+		return Entry{}, err
+	}
+	entry.Algorithm = algorithm.String
+	entry.PartialSize = int(partialSize.Int64)
+	entry.Size = size.Int64
+	entry.ModTime = time.Unix(0, mtime.Int64)
+	entry.ChangeTime = time.Unix(0, ctime.Int64)
+	entry.Inode = uint64(inode.Int64)
+	entry.Device = uint64(device.Int64)
+	return entry, nil
+}
+
+func (s *SQLiteCache) GetByHash(hash []byte) ([]string, error) {
+	return s.queryKeys("SELECT key FROM cache WHERE value = ?", hash)
+}
+
+func (s *SQLiteCache) GetByPartialHash(partial []byte) ([]string, error) {
+	return s.queryKeys("SELECT key FROM cache WHERE partial = ?", partial)
+}
+
+func (s *SQLiteCache) queryKeys(query string, args ...any) ([]string, error) {
+	err := s.writer.flush()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
 	}
-	return exists, nil
+	return keys, rows.Err()
 }
 
+// Close commits any queued writes before closing the database.
 func (s *SQLiteCache) Close() error {
-	return s.db.Close()
+	return errors.Join(s.writer.close(), s.db.Close())
 }
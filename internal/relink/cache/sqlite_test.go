@@ -0,0 +1,84 @@
+package cache_test
+
+import (
+	"bytes"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/USA-RedDragon/relink/internal/relink/cache"
+)
+
+func TestSQLiteCacheUpgradesBaselineSchema(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "cache.db")
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	_, err = db.Exec(`
+	CREATE TABLE cache (
+		key TEXT PRIMARY KEY,
+		value BLOB
+	);
+	INSERT INTO cache (key, value) VALUES ('a', x'01'), ('b', x'02');
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create baseline schema: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close database: %v", err)
+	}
+
+	cc, err := cache.NewSQLiteCache(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteCache failed: %v", err)
+	}
+	for key, hash := range map[string][]byte{"a": {1}, "b": {2}} {
+		entry, ok, err := cc.Get(key)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if !ok || !bytes.Equal(entry.Hash, hash) {
+			t.Errorf("Get(%s) = %x, %v, want %x, true", key, entry.Hash, ok, hash)
+		}
+	}
+	if err := cc.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	db, err = sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		t.Fatalf("Failed to get schema version: %v", err)
+	}
+	if version != 4 {
+		t.Errorf("Expected schema version 4, got %d", version)
+	}
+	for _, column := range []string{"partial", "algorithm", "partial_size", "size", "mtime", "ctime", "inode", "device"} {
+		var exists bool
+		err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM pragma_table_info('cache') WHERE name = ?)", column).Scan(&exists)
+		if err != nil {
+			t.Fatalf("Failed to check column %s: %v", column, err)
+		}
+		if !exists {
+			t.Errorf("Expected column %s to exist", column)
+		}
+	}
+	for _, index := range []string{"cache_value", "cache_partial"} {
+		var exists bool
+		err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'index' AND name = ?)", index).Scan(&exists)
+		if err != nil {
+			t.Fatalf("Failed to check index %s: %v", index, err)
+		}
+		if !exists {
+			t.Errorf("Expected index %s to exist", index)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package relink
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+var ErrDedupeRangeDiffers = errors.New("file contents differ from the source")
+
+// dedupeChunkSize is the most each FIDEDUPERANGE call is asked to share.
+// Btrfs silently caps a single request at 16 MiB.
+const dedupeChunkSize = 16 << 20
+
+// DedupeRange asks the kernel to share the extents of source with target.
+// The kernel compares the contents under a lock before sharing them and
+// returns ErrDedupeRangeDiffers if they don't match, so a target modified
+// since planning is never replaced. The target keeps its inode, owner, mode
+// and timestamps.
+func DedupeRange(source, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer in.Close()
+
+	// Opening the target read-only is enough for the files the caller owns
+	out, err := os.Open(target)
+	if err != nil {
+		return fmt.Errorf("failed to open target file: %w", err)
+	}
+	defer out.Close()
+
+	sourceInfo, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat source file: %w", err)
+	}
+	targetInfo, err := out.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat target file: %w", err)
+	}
+	if sourceInfo.Size() != targetInfo.Size() {
+		return ErrDedupeRangeDiffers
+	}
+
+	size := uint64(sourceInfo.Size())
+	for offset := uint64(0); offset < size; {
+		dedupe := unix.FileDedupeRange{
+			Src_offset: offset,
+			Src_length: min(size-offset, dedupeChunkSize),
+			Info: []unix.FileDedupeRangeInfo{{
+				Dest_fd:     int64(out.Fd()),
+				Dest_offset: offset,
+			}},
+		}
+		err := unix.IoctlFileDedupeRange(int(in.Fd()), &dedupe)
+		if err != nil {
+			return fmt.Errorf("failed to dedupe %s into %s: %w", source, target, reflinkError(err))
+		}
+
+		result := dedupe.Info[0]
+		switch {
+		case result.Status == unix.FILE_DEDUPE_RANGE_DIFFERS:
+			return ErrDedupeRangeDiffers
+		case result.Status < 0:
+			return fmt.Errorf("failed to dedupe %s into %s: %w", source, target, reflinkError(unix.Errno(-result.Status)))
+		case result.Bytes_deduped == 0:
+			return fmt.Errorf("failed to dedupe %s into %s: no bytes were shared at offset %d", source, target, offset)
+		}
+		offset += result.Bytes_deduped
+	}
+	return nil
+}
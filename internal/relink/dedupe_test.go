@@ -0,0 +1,75 @@
+package relink_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/USA-RedDragon/relink/internal/relink"
+)
+
+func TestDedupeRange_Success(t *testing.T) {
+	t.Parallel()
+	tempDir, sourcePath, targetPath := setupTestFiles(t)
+	defer cleanupTestFiles(t, tempDir)
+
+	if err := os.WriteFile(targetPath, []byte("test content"), 0640); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+	before, err := os.Stat(targetPath)
+	if err != nil {
+		t.Fatalf("Failed to stat target file: %v", err)
+	}
+
+	err = relink.DedupeRange(sourcePath, targetPath)
+	if errors.Is(err, relink.ErrReflinkNotSupported) {
+		t.Skipf("Filesystem does not support dedupe: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("DedupeRange failed: %v", err)
+	}
+
+	after, err := os.Stat(targetPath)
+	if err != nil {
+		t.Fatalf("Failed to stat target file: %v", err)
+	}
+	if !os.SameFile(before, after) {
+		t.Error("Deduped target should keep its inode")
+	}
+	if after.Mode() != before.Mode() || !after.ModTime().Equal(before.ModTime()) {
+		t.Error("Deduped target should keep its metadata")
+	}
+}
+
+func TestDedupeRange_ContentDiffers(t *testing.T) {
+	t.Parallel()
+	tempDir, sourcePath, targetPath := setupTestFiles(t)
+	defer cleanupTestFiles(t, tempDir)
+
+	if err := os.WriteFile(targetPath, []byte("test CONTENT"), 0600); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	err := relink.DedupeRange(sourcePath, targetPath)
+	if errors.Is(err, relink.ErrReflinkNotSupported) {
+		t.Skipf("Filesystem does not support dedupe: %v", err)
+	}
+	if !errors.Is(err, relink.ErrDedupeRangeDiffers) {
+		t.Errorf("DedupeRange() error = %v, want %v", err, relink.ErrDedupeRangeDiffers)
+	}
+}
+
+func TestDedupeRange_SizeDiffers(t *testing.T) {
+	t.Parallel()
+	tempDir, sourcePath, targetPath := setupTestFiles(t)
+	defer cleanupTestFiles(t, tempDir)
+
+	if err := os.WriteFile(targetPath, []byte("longer test content"), 0600); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	err := relink.DedupeRange(sourcePath, targetPath)
+	if !errors.Is(err, relink.ErrDedupeRangeDiffers) {
+		t.Errorf("DedupeRange() error = %v, want %v", err, relink.ErrDedupeRangeDiffers)
+	}
+}
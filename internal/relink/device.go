@@ -0,0 +1,30 @@
+package relink
+
+import (
+	"io/fs"
+	"log/slog"
+
+	"github.com/USA-RedDragon/relink/internal/config"
+)
+
+// crossDeviceLinkMode applies the cross-device policy to a target on a
+// different device than its source, which hardlinks can't span. It returns
+// the link mode to plan the entry with, empty to use the configured one, and
+// false if the target should be skipped.
+func crossDeviceLinkMode(cfg *config.Config, source, target string, sourceInfo, targetInfo fs.FileInfo) (config.LinkMode, bool) {
+	if cfg.LinkMode == config.LinkModeSymlink || device(sourceInfo) == device(targetInfo) {
+		return "", true
+	}
+
+	switch cfg.CrossDevice {
+	case config.CrossDeviceSymlink:
+		return config.LinkModeSymlink, true
+	case config.CrossDeviceReflink:
+		return config.LinkModeReflink, true
+	case config.CrossDeviceSkip:
+		fallthrough
+	default:
+		slog.Warn("skipping file on a different device than its source", "source", source, "target", target)
+		return "", false
+	}
+}
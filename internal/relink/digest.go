@@ -0,0 +1,68 @@
+package relink
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/USA-RedDragon/relink/internal/config"
+	"github.com/USA-RedDragon/relink/internal/relink/cache"
+	"golang.org/x/sync/singleflight"
+)
+
+// hashWithProgress hashes the full file, adding the bytes read to progress
+// as it goes.
+func hashWithProgress(path string, cfg *config.Config, progress *atomic.Uint64) ([]byte, error) {
+	readBytesChan := make(chan uint64)
+	var hash []byte
+	var err error
+	go func() {
+		hash, err = HashFile(path, cfg.HashAlgorithm, cfg.BufferSize, readBytesChan)
+		close(readBytesChan)
+	}()
+	for readBytes := range readBytesChan {
+		progress.Add(readBytes)
+	}
+	return hash, err
+}
+
+// digest computes the cache entry for a file. Files too small for a partial
+// hash to save any reads are hashed in full, and use the full hash as their
+// partial hash.
+func digest(file FileInfo, cfg *config.Config, progress *atomic.Uint64) (cache.Entry, error) {
+	size := file.Info.Size()
+	if cfg.PartialHashSize == 0 || size <= 2*int64(cfg.PartialHashSize) {
+		hash, err := hashWithProgress(file.Path, cfg, progress)
+		if err != nil {
+			return cache.Entry{}, err
+		}
+		return cache.Entry{Metadata: metadata(file.Info), Algorithm: string(cfg.HashAlgorithm), PartialSize: cfg.PartialHashSize, Partial: hash, Hash: hash}, nil
+	}
+
+	partial, err := PartialHashFile(file.Path, cfg.HashAlgorithm, size, cfg.PartialHashSize)
+	if err != nil {
+		return cache.Entry{}, err
+	}
+	progress.Add(uint64(size))
+	return cache.Entry{Metadata: metadata(file.Info), Algorithm: string(cfg.HashAlgorithm), PartialSize: cfg.PartialHashSize, Partial: partial}, nil
+}
+
+// ensureFullHash computes and caches the full hash of a source file that so
+// far only has a partial hash. Concurrent calls for the same file share a
+// single read.
+func ensureFullHash(cc cache.Cache, group *singleflight.Group, path string, cfg *config.Config) error {
+	_, err, _ := group.Do(path, func() (any, error) {
+		entry, ok, err := cc.Get(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get source from cache: %w", err)
+		}
+		if !ok || entry.Hash != nil || entry.Algorithm != string(cfg.HashAlgorithm) || entry.PartialSize != cfg.PartialHashSize {
+			return entry.Hash, nil
+		}
+		entry.Hash, err = HashFile(path, cfg.HashAlgorithm, cfg.BufferSize, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash source file: %w", err)
+		}
+		return entry.Hash, cc.Put(path, entry)
+	})
+	return err
+}
@@ -0,0 +1,125 @@
+package relink
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"unsafe"
+
+	"github.com/USA-RedDragon/relink/internal/config"
+	"golang.org/x/sys/unix"
+)
+
+// The FIEMAP ioctl and its structs from linux/fiemap.h, which x/sys/unix
+// doesn't provide.
+const (
+	fsIocFiemap       = 0xC020660B
+	fiemapFlagSync    = 0x1
+	fiemapExtentLast  = 0x1
+	fiemapExtentBatch = 64
+	// fiemapUnusable marks extents whose physical offset is unknown or
+	// meaningless: unknown, delayed allocation, encoded or inline data.
+	fiemapUnusable = 0x2 | 0x4 | 0x8 | 0x200
+)
+
+type fiemapExtent struct {
+	Logical  uint64
+	Physical uint64
+	Length   uint64
+	_        [2]uint64
+	Flags    uint32
+	_        [3]uint32
+}
+
+type fiemap struct {
+	Start         uint64
+	Length        uint64
+	Flags         uint32
+	MappedExtents uint32
+	ExtentCount   uint32
+	_             uint32
+	Extents       [fiemapExtentBatch]fiemapExtent
+}
+
+// alreadyShared reports whether a target planned with a link mode that shares
+// extents already shares every one of them with its source, as it does after
+// an earlier run, so cloning or deduping it again would change nothing.
+func alreadyShared(cfg *config.Config, linkMode config.LinkMode, source, target string) (bool, error) {
+	if linkMode == "" {
+		linkMode = cfg.LinkMode
+	}
+	if linkMode != config.LinkModeReflink && linkMode != config.LinkModeDedupeRange {
+		return false, nil
+	}
+	return SharesExtents(source, target)
+}
+
+// SharesExtents reports whether both files map their contents to the same
+// physical extents. Filesystems that can't report their extents share none.
+func SharesExtents(source, target string) (bool, error) {
+	sourceExtents, err := extents(source)
+	if err != nil {
+		return false, fmt.Errorf("failed to map extents of %s: %w", source, err)
+	}
+	targetExtents, err := extents(target)
+	if err != nil {
+		return false, fmt.Errorf("failed to map extents of %s: %w", target, err)
+	}
+	if len(sourceExtents) == 0 {
+		return false, nil
+	}
+	return slices.Equal(sourceExtents, targetExtents), nil
+}
+
+// extents maps the file at path with FIEMAP, merging extents that continue
+// each other since filesystems may split a range differently between files
+// sharing it. Files with extents whose physical location isn't known are
+// treated as having none.
+func extents(path string) ([]fiemapExtent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	merged := []fiemapExtent{}
+	for start := uint64(0); ; {
+		fm := fiemap{
+			Start:       start,
+			Length:      math.MaxUint64 - start,
+			Flags:       fiemapFlagSync,
+			ExtentCount: fiemapExtentBatch,
+		}
+		_, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), fsIocFiemap, uintptr(unsafe.Pointer(&fm)))
+		if errors.Is(errno, unix.EOPNOTSUPP) || errors.Is(errno, unix.ENOTTY) {
+			return nil, nil
+		}
+		if errno != 0 {
+			return nil, errno
+		}
+		if fm.MappedExtents == 0 {
+			return merged, nil
+		}
+
+		for _, extent := range fm.Extents[:fm.MappedExtents] {
+			if extent.Flags&fiemapUnusable != 0 {
+				return nil, nil
+			}
+			if n := len(merged); n > 0 &&
+				merged[n-1].Logical+merged[n-1].Length == extent.Logical &&
+				merged[n-1].Physical+merged[n-1].Length == extent.Physical {
+				merged[n-1].Length += extent.Length
+				continue
+			}
+			merged = append(merged, fiemapExtent{Logical: extent.Logical, Physical: extent.Physical, Length: extent.Length})
+		}
+
+		last := fm.Extents[fm.MappedExtents-1]
+		if last.Flags&fiemapExtentLast != 0 {
+			return merged, nil
+		}
+		start = last.Logical + last.Length
+	}
+}
@@ -0,0 +1,233 @@
+package relink_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/USA-RedDragon/relink/internal/config"
+	"github.com/USA-RedDragon/relink/internal/relink"
+	"golang.org/x/sys/unix"
+)
+
+// mountReflinkFilesystem mounts a loop image of a filesystem that can share
+// extents between files, skipping the test unless it runs as root with
+// mkfs.btrfs or mkfs.xfs installed.
+func mountReflinkFilesystem(t *testing.T) string {
+	t.Helper()
+	if os.Geteuid() != 0 {
+		t.Skip("Mounting a loop image requires root")
+	}
+	var mkfs []string
+	for _, args := range [][]string{{"mkfs.btrfs", "-q"}, {"mkfs.xfs", "-q", "-m", "reflink=1"}} {
+		if _, err := exec.LookPath(args[0]); err == nil {
+			mkfs = args
+			break
+		}
+	}
+	if mkfs == nil {
+		t.Skip("Neither mkfs.btrfs nor mkfs.xfs is installed")
+	}
+
+	dir := t.TempDir()
+	image := filepath.Join(dir, "fs.img")
+	f, err := os.Create(image)
+	if err != nil {
+		t.Fatalf("Failed to create image: %v", err)
+	}
+	err = f.Truncate(512 << 20)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		t.Fatalf("Failed to size image: %v", err)
+	}
+	if out, err := exec.Command(mkfs[0], append(mkfs[1:], image)...).CombinedOutput(); err != nil {
+		t.Skipf("Failed to create filesystem: %v: %s", err, out)
+	}
+
+	mountPoint := filepath.Join(dir, "mnt")
+	if err := os.Mkdir(mountPoint, 0700); err != nil {
+		t.Fatalf("Failed to create mount point: %v", err)
+	}
+	if out, err := exec.Command("mount", "-o", "loop", image, mountPoint).CombinedOutput(); err != nil {
+		t.Skipf("Failed to mount image: %v: %s", err, out)
+	}
+	t.Cleanup(func() {
+		if out, err := exec.Command("umount", mountPoint).CombinedOutput(); err != nil {
+			t.Errorf("Failed to unmount image: %v: %s", err, out)
+		}
+	})
+	return mountPoint
+}
+
+// writeDuplicates writes the same random content to every path, large enough
+// to be stored in extents rather than inline.
+func writeDuplicates(t *testing.T, paths ...string) []byte {
+	t.Helper()
+	content := make([]byte, 256<<10)
+	if _, err := rand.Read(content); err != nil {
+		t.Fatalf("Failed to generate content: %v", err)
+	}
+	for _, path := range paths {
+		if err := os.WriteFile(path, content, 0600); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+	return content
+}
+
+func assertSharesExtents(t *testing.T, source, target string, want bool) {
+	t.Helper()
+	shared, err := relink.SharesExtents(source, target)
+	if err != nil {
+		t.Fatalf("SharesExtents failed: %v", err)
+	}
+	if shared != want {
+		t.Errorf("SharesExtents(%s, %s) = %v, want %v", source, target, shared, want)
+	}
+}
+
+func TestSharesExtents(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	sourcePath := filepath.Join(dir, "source")
+	copyPath := filepath.Join(dir, "copy")
+	linkPath := filepath.Join(dir, "link")
+	writeDuplicates(t, sourcePath, copyPath)
+	if err := os.Link(sourcePath, linkPath); err != nil {
+		t.Fatalf("Failed to create hardlink: %v", err)
+	}
+
+	shared, err := relink.SharesExtents(sourcePath, linkPath)
+	if err != nil {
+		t.Fatalf("SharesExtents failed: %v", err)
+	}
+	if !shared {
+		t.Skip("Filesystem does not report extents")
+	}
+	assertSharesExtents(t, sourcePath, copyPath, false)
+}
+
+func TestSharedExtentsOnReflinkFilesystem(t *testing.T) {
+	t.Parallel()
+	mountPoint := mountReflinkFilesystem(t)
+
+	t.Run("reflinks a target", func(t *testing.T) {
+		dir, err := os.MkdirTemp(mountPoint, "reflink-*")
+		if err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		sourcePath := filepath.Join(dir, "source")
+		targetPath := filepath.Join(dir, "target")
+		content := writeDuplicates(t, sourcePath, targetPath)
+		assertSharesExtents(t, sourcePath, targetPath, false)
+
+		if err := relink.AtomicReflink(sourcePath, targetPath, nil); err != nil {
+			t.Fatalf("AtomicReflink failed: %v", err)
+		}
+		assertSharesExtents(t, sourcePath, targetPath, true)
+		got, err := os.ReadFile(targetPath)
+		if err != nil {
+			t.Fatalf("Failed to read target file: %v", err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Error("Reflinked target content differs from the source")
+		}
+	})
+
+	t.Run("reflinks keep the target's extended attributes", func(t *testing.T) {
+		dir, err := os.MkdirTemp(mountPoint, "xattrs-*")
+		if err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		sourcePath := filepath.Join(dir, "source")
+		targetPath := filepath.Join(dir, "target")
+		writeDuplicates(t, sourcePath, targetPath)
+		if err := unix.Lsetxattr(targetPath, "user.relink", []byte("test"), 0); err != nil {
+			t.Fatalf("Failed to set extended attribute: %v", err)
+		}
+
+		err = relink.AtomicReflink(sourcePath, targetPath, func(differences []string) error {
+			t.Errorf("Reflink lost the target's %v", differences)
+			return relink.ErrMetadataMismatch
+		})
+		if err != nil {
+			t.Fatalf("AtomicReflink failed: %v", err)
+		}
+		value := make([]byte, 16)
+		n, err := unix.Lgetxattr(targetPath, "user.relink", value)
+		if err != nil {
+			t.Fatalf("Failed to get extended attribute: %v", err)
+		}
+		if string(value[:n]) != "test" {
+			t.Errorf("Target extended attribute = %q, want %q", value[:n], "test")
+		}
+	})
+
+	t.Run("dedupes a target", func(t *testing.T) {
+		dir, err := os.MkdirTemp(mountPoint, "dedupe-*")
+		if err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		sourcePath := filepath.Join(dir, "source")
+		targetPath := filepath.Join(dir, "target")
+		writeDuplicates(t, sourcePath, targetPath)
+		before, err := os.Stat(targetPath)
+		if err != nil {
+			t.Fatalf("Failed to stat target file: %v", err)
+		}
+
+		if err := relink.DedupeRange(sourcePath, targetPath); err != nil {
+			t.Fatalf("DedupeRange failed: %v", err)
+		}
+		assertSharesExtents(t, sourcePath, targetPath, true)
+		after, err := os.Stat(targetPath)
+		if err != nil {
+			t.Fatalf("Failed to stat target file: %v", err)
+		}
+		if !os.SameFile(before, after) {
+			t.Error("Deduped target should keep its inode")
+		}
+	})
+
+	for _, linkMode := range []config.LinkMode{config.LinkModeReflink, config.LinkModeDedupeRange} {
+		t.Run("plans only targets not sharing extents in "+string(linkMode)+" mode", func(t *testing.T) {
+			sourceDir, err := os.MkdirTemp(mountPoint, "source-*")
+			if err != nil {
+				t.Fatalf("Failed to create source directory: %v", err)
+			}
+			targetDir, err := os.MkdirTemp(mountPoint, "target-*")
+			if err != nil {
+				t.Fatalf("Failed to create target directory: %v", err)
+			}
+			sourcePath := filepath.Join(sourceDir, "file")
+			clonedPath := filepath.Join(targetDir, "cloned")
+			copyPath := filepath.Join(targetDir, "copy")
+			writeDuplicates(t, sourcePath, clonedPath, copyPath)
+			if err := relink.AtomicReflink(sourcePath, clonedPath, nil); err != nil {
+				t.Fatalf("AtomicReflink failed: %v", err)
+			}
+
+			cfg := &config.Config{
+				Source:        []string{sourceDir},
+				Target:        []string{targetDir},
+				HashJobs:      4,
+				BufferSize:    4096,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      linkMode,
+			}
+			plan, err := relink.BuildPlan(cfg)
+			if err != nil {
+				t.Fatalf("BuildPlan failed: %v", err)
+			}
+			if len(plan.Entries) != 1 || plan.Entries[0].Target != copyPath {
+				t.Errorf("Expected only %s to be planned, got %v", copyPath, plan.Entries)
+			}
+		})
+	}
+}
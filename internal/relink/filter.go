@@ -0,0 +1,126 @@
+package relink
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// RegexPrefix marks a filter pattern as a regular expression instead of a
+// glob.
+const RegexPrefix = "regex:"
+
+// Filter decides which paths in a tree are walked. Paths are matched relative
+// to the root of the tree, with forward slashes. A nil Filter matches
+// everything.
+type Filter struct {
+	include []pattern
+	exclude []pattern
+	// MinSize and MaxSize limit the size of the files walked. A MaxSize of 0
+	// means no limit.
+	MinSize uint64
+	MaxSize uint64
+}
+
+// pattern is either a doublestar glob or a regular expression. Globs without
+// a slash match the base name at any depth, like .gitignore patterns, while
+// regular expressions are always matched against the whole relative path.
+type pattern struct {
+	glob  string
+	regex *regexp.Regexp
+}
+
+func NewFilter(include, exclude []string) (*Filter, error) {
+	filter := &Filter{}
+	for _, raw := range include {
+		p, err := parsePattern(raw)
+		if err != nil {
+			return nil, err
+		}
+		filter.include = append(filter.include, p)
+	}
+	for _, raw := range exclude {
+		p, err := parsePattern(raw)
+		if err != nil {
+			return nil, err
+		}
+		filter.exclude = append(filter.exclude, p)
+	}
+	return filter, nil
+}
+
+func parsePattern(raw string) (pattern, error) {
+	if expr, ok := strings.CutPrefix(raw, RegexPrefix); ok {
+		regex, err := regexp.Compile(expr)
+		if err != nil {
+			return pattern{}, fmt.Errorf("invalid regex %q: %w", expr, err)
+		}
+		return pattern{regex: regex}, nil
+	}
+	if !doublestar.ValidatePattern(raw) {
+		return pattern{}, fmt.Errorf("invalid glob %q: %w", raw, doublestar.ErrBadPattern)
+	}
+	return pattern{glob: raw}, nil
+}
+
+func (p pattern) match(rel string) bool {
+	if p.regex != nil {
+		return p.regex.MatchString(rel)
+	}
+	name := rel
+	if !strings.Contains(p.glob, "/") {
+		name = path.Base(rel)
+	}
+	// The pattern was validated when the filter was created
+	matched, _ := doublestar.Match(p.glob, name)
+	return matched
+}
+
+// Excluded reports whether a file or directory matches an exclude pattern.
+// An excluded directory is skipped along with everything in it.
+func (f *Filter) Excluded(rel string) bool {
+	if f == nil {
+		return false
+	}
+	for _, p := range f.exclude {
+		if p.match(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether a file is walked. It must not be excluded, and if
+// there are include patterns it must match one of them.
+func (f *Filter) Allows(rel string) bool {
+	if f == nil {
+		return true
+	}
+	if f.Excluded(rel) {
+		return false
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, p := range f.include {
+		if p.match(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsSize reports whether a file of the given size is within the size
+// limits.
+func (f *Filter) AllowsSize(size int64) bool {
+	if f == nil {
+		return true
+	}
+	if uint64(size) < f.MinSize {
+		return false
+	}
+	return f.MaxSize == 0 || uint64(size) <= f.MaxSize
+}
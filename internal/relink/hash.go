@@ -1,15 +1,50 @@
 package relink
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"hash"
 	"io"
 	"os"
 
+	"github.com/USA-RedDragon/relink/internal/config"
+	"github.com/zeebo/blake3"
+	"github.com/zeebo/xxh3"
 	"golang.org/x/crypto/blake2b"
 )
 
-func HashFile(filePath string, bufferSize int, readBytesChan chan uint64) (ret []byte, err error) {
-	b2b, err := blake2b.New512(nil)
+// xxh3Hash128 adapts the streaming XXH3 hasher to produce the 128-bit
+// variant, since 64 bits is too few to rule out collisions between files.
+type xxh3Hash128 struct {
+	*xxh3.Hasher
+}
+
+func (x xxh3Hash128) Size() int { return 16 }
+
+func (x xxh3Hash128) Sum(b []byte) []byte {
+	sum := x.Sum128().Bytes()
+	return append(b, sum[:]...)
+}
+
+func NewHash(algorithm config.HashAlgorithm) (hash.Hash, error) {
+	switch algorithm {
+	case config.HashAlgorithmBLAKE2b:
+		return blake2b.New512(nil)
+	case config.HashAlgorithmBLAKE3:
+		return blake3.New(), nil
+	case config.HashAlgorithmSHA256:
+		return sha256.New(), nil
+	case config.HashAlgorithmXXH3:
+		return xxh3Hash128{xxh3.New()}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", config.ErrInvalidHashAlgorithm, algorithm)
+	}
+}
+
+func HashFile(filePath string, algorithm config.HashAlgorithm, bufferSize int, readBytesChan chan uint64) (ret []byte, err error) {
+	hasher, err := NewHash(algorithm)
 	if err != nil {
 		return
 	}
@@ -32,7 +67,7 @@ func HashFile(filePath string, bufferSize int, readBytesChan chan uint64) (ret [
 		if readBytesChan != nil {
 			readBytesChan <- uint64(readN)
 		}
-		writeN, err := b2b.Write(buf[:readN])
+		writeN, err := hasher.Write(buf[:readN])
 		if err != nil {
 			return nil, err
 		}
@@ -41,5 +76,42 @@ func HashFile(filePath string, bufferSize int, readBytesChan chan uint64) (ret [
 		}
 	}
 
-	return b2b.Sum(nil), nil
+	return hasher.Sum(nil), nil
+}
+
+func PartialHashFile(filePath string, algorithm config.HashAlgorithm, size int64, blockSize int) ([]byte, error) {
+	hasher, err := NewHash(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := binary.Write(hasher, binary.LittleEndian, size); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, min(int64(blockSize), size))
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return nil, err
+	}
+	if _, err := hasher.Write(buf); err != nil {
+		return nil, err
+	}
+
+	if size > int64(blockSize) {
+		buf = buf[:min(int64(blockSize), size-int64(blockSize))]
+		if _, err := f.ReadAt(buf, size-int64(len(buf))); err != nil {
+			return nil, err
+		}
+		if _, err := hasher.Write(buf); err != nil {
+			return nil, err
+		}
+	}
+
+	return hasher.Sum(nil), nil
 }
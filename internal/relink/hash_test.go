@@ -1,11 +1,17 @@
 package relink_test
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/USA-RedDragon/relink/internal/config"
 	"github.com/USA-RedDragon/relink/internal/relink"
+	"github.com/zeebo/blake3"
+	"github.com/zeebo/xxh3"
 	"golang.org/x/crypto/blake2b"
 )
 
@@ -38,7 +44,7 @@ func TestHashFileRegular(t *testing.T) {
 	expectedSum := expectedHash.Sum(nil)
 
 	// Test HashFile
-	actualHash, err := relink.HashFile(filePath, testBuffer, nil)
+	actualHash, err := relink.HashFile(filePath, config.HashAlgorithmBLAKE2b, testBuffer, nil)
 	if err != nil {
 		t.Fatalf("HashFile failed: %v", err)
 	}
@@ -71,7 +77,7 @@ func TestHashFileEmpty(t *testing.T) {
 	}
 	expectedSum := expectedHash.Sum(nil)
 
-	actualHash, err := relink.HashFile(filePath, testBuffer, nil)
+	actualHash, err := relink.HashFile(filePath, config.HashAlgorithmBLAKE2b, testBuffer, nil)
 	if err != nil {
 		t.Fatalf("HashFile failed: %v", err)
 	}
@@ -111,7 +117,7 @@ func TestHashFileLarge(t *testing.T) {
 	}
 	expectedSum := expectedHash.Sum(nil)
 
-	actualHash, err := relink.HashFile(filePath, testBuffer, nil)
+	actualHash, err := relink.HashFile(filePath, config.HashAlgorithmBLAKE2b, testBuffer, nil)
 	if err != nil {
 		t.Fatalf("HashFile failed: %v", err)
 	}
@@ -148,7 +154,7 @@ func TestHashFileSpecialChars(t *testing.T) {
 	}
 	expectedSum := expectedHash.Sum(nil)
 
-	actualHash, err := relink.HashFile(filePath, testBuffer, nil)
+	actualHash, err := relink.HashFile(filePath, config.HashAlgorithmBLAKE2b, testBuffer, nil)
 	if err != nil {
 		t.Fatalf("HashFile failed: %v", err)
 	}
@@ -170,7 +176,7 @@ func TestHashFileNotExist(t *testing.T) {
 	}
 	defer os.RemoveAll(tmpDir)
 
-	_, err = relink.HashFile(filepath.Join(tmpDir, "nonexistent.txt"), testBuffer, nil)
+	_, err = relink.HashFile(filepath.Join(tmpDir, "nonexistent.txt"), config.HashAlgorithmBLAKE2b, testBuffer, nil)
 	if err == nil {
 		t.Error("Expected error for nonexistent file, got nil")
 	}
@@ -192,7 +198,7 @@ func TestHashFilePermissionDenied(t *testing.T) {
 		t.Fatalf("Failed to write test file: %v", err)
 	}
 
-	_, err = relink.HashFile(filePath, testBuffer, nil)
+	_, err = relink.HashFile(filePath, config.HashAlgorithmBLAKE2b, testBuffer, nil)
 	if err == nil {
 		t.Error("Expected error for permission denied, got nil")
 	}
@@ -200,3 +206,96 @@ func TestHashFilePermissionDenied(t *testing.T) {
 		t.Errorf("Expected IsPermission error, got %v", err)
 	}
 }
+
+func TestPartialHashFile(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+
+	// Same size, start, and end, but different in the middle
+	first := filepath.Join(tmpDir, "first.txt")
+	if err := os.WriteFile(first, []byte("head-aaaa-tail"), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	second := filepath.Join(tmpDir, "second.txt")
+	if err := os.WriteFile(second, []byte("head-bbbb-tail"), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	third := filepath.Join(tmpDir, "third.txt")
+	if err := os.WriteFile(third, []byte("HEAD-aaaa-tail"), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	firstHash, err := relink.PartialHashFile(first, config.HashAlgorithmBLAKE2b, 14, 4)
+	if err != nil {
+		t.Fatalf("PartialHashFile failed: %v", err)
+	}
+	secondHash, err := relink.PartialHashFile(second, config.HashAlgorithmBLAKE2b, 14, 4)
+	if err != nil {
+		t.Fatalf("PartialHashFile failed: %v", err)
+	}
+	thirdHash, err := relink.PartialHashFile(third, config.HashAlgorithmBLAKE2b, 14, 4)
+	if err != nil {
+		t.Fatalf("PartialHashFile failed: %v", err)
+	}
+
+	if !bytes.Equal(firstHash, secondHash) {
+		t.Error("Partial hashes should only cover the start and end of the file")
+	}
+	if bytes.Equal(firstHash, thirdHash) {
+		t.Error("Partial hashes should differ when the start of the file differs")
+	}
+
+	// A block size covering the whole file still reads every byte once
+	fullHash, err := relink.PartialHashFile(first, config.HashAlgorithmBLAKE2b, 14, testBuffer)
+	if err != nil {
+		t.Fatalf("PartialHashFile failed: %v", err)
+	}
+	otherFullHash, err := relink.PartialHashFile(second, config.HashAlgorithmBLAKE2b, 14, testBuffer)
+	if err != nil {
+		t.Fatalf("PartialHashFile failed: %v", err)
+	}
+	if bytes.Equal(fullHash, otherFullHash) {
+		t.Error("Partial hashes should differ when the block size covers the whole file")
+	}
+}
+
+func TestHashFileAlgorithms(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("Hello, World!")
+	filePath := filepath.Join(t.TempDir(), "test.txt")
+	if err := os.WriteFile(filePath, content, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	blake3Sum := blake3.Sum256(content)
+	sha256Sum := sha256.Sum256(content)
+	xxh3Sum := xxh3.Hash128(content).Bytes()
+
+	tests := []struct {
+		algorithm config.HashAlgorithm
+		want      []byte
+	}{
+		{config.HashAlgorithmBLAKE3, blake3Sum[:]},
+		{config.HashAlgorithmSHA256, sha256Sum[:]},
+		{config.HashAlgorithmXXH3, xxh3Sum[:]},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.algorithm), func(t *testing.T) {
+			t.Parallel()
+			got, err := relink.HashFile(filePath, tt.algorithm, testBuffer, nil)
+			if err != nil {
+				t.Fatalf("HashFile failed: %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("HashFile() = %x, want %x", got, tt.want)
+			}
+		})
+	}
+
+	_, err := relink.HashFile(filePath, "md5", testBuffer, nil)
+	if !errors.Is(err, config.ErrInvalidHashAlgorithm) {
+		t.Errorf("Expected ErrInvalidHashAlgorithm, got %v", err)
+	}
+}
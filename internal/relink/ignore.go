@@ -0,0 +1,105 @@
+package relink
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gitignore "github.com/sabhiram/go-gitignore"
+)
+
+// IgnoreFile is the name of the files, in gitignore syntax, that exclude
+// paths from the directory they are in and everything below it.
+const IgnoreFile = ".relinkignore"
+
+type ignoreFile struct {
+	dir   string
+	rules []ignoreRule
+}
+
+// ignoreRule is a single line of an ignore file. Lines are compiled one at a
+// time because a GitIgnore only reports whether a path ended up ignored, not
+// whether a negated line matched it.
+type ignoreRule struct {
+	negate  bool
+	pattern *gitignore.GitIgnore
+}
+
+func parseIgnoreFile(dir string, content []byte) ignoreFile {
+	file := ignoreFile{dir: dir}
+	for line := range strings.Lines(string(content)) {
+		line = strings.TrimRight(line, "\r\n")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line, negate := strings.CutPrefix(line, "!")
+		file.rules = append(file.rules, ignoreRule{
+			negate:  negate,
+			pattern: gitignore.CompileIgnoreLines(line),
+		})
+	}
+	return file
+}
+
+// ignoreStack holds the ignore files of the directory being walked and its
+// ancestors, outermost first. It relies on the walk visiting each directory
+// before its contents and finishing a subtree before moving on.
+type ignoreStack struct {
+	files []ignoreFile
+}
+
+// enter loads the ignore file in dir, if there is one.
+func (s *ignoreStack) enter(dir string) error {
+	s.unwind(dir)
+	path := filepath.Join(dir, IgnoreFile)
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	s.files = append(s.files, parseIgnoreFile(dir, content))
+	return nil
+}
+
+// unwind drops the ignore files of directories that don't contain path.
+func (s *ignoreStack) unwind(path string) {
+	for len(s.files) > 0 {
+		dir := s.files[len(s.files)-1].dir
+		if !strings.HasSuffix(dir, string(filepath.Separator)) {
+			dir += string(filepath.Separator)
+		}
+		if strings.HasPrefix(path, dir) {
+			return
+		}
+		s.files = s.files[:len(s.files)-1]
+	}
+}
+
+// ignored reports whether path is ignored. Like git, the last matching line
+// wins and ignore files deeper in the tree take precedence, so a negated
+// pattern can re-include a path that an outer ignore file matched.
+func (s *ignoreStack) ignored(path string, isDir bool) bool {
+	s.unwind(path)
+	ignored := false
+	for _, file := range s.files {
+		rel, err := filepath.Rel(file.dir, path)
+		if err != nil {
+			continue
+		}
+		if isDir {
+			// Patterns with a trailing slash only match directories
+			rel += string(filepath.Separator)
+		}
+		for _, rule := range file.rules {
+			if rule.pattern.MatchesPath(rel) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
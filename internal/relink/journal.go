@@ -0,0 +1,111 @@
+package relink
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/relink/internal/config"
+)
+
+type JournalEntry struct {
+	Target        string               `json:"target"`
+	Source        string               `json:"source"`
+	Inode         uint64               `json:"inode"`
+	Size          uint64               `json:"size"`
+	Mode          fs.FileMode          `json:"mode"`
+	UID           uint32               `json:"uid"`
+	GID           uint32               `json:"gid"`
+	ModTime       time.Time            `json:"mtime"`
+	AccessTime    time.Time            `json:"atime"`
+	Hash          string               `json:"hash"`
+	HashAlgorithm config.HashAlgorithm `json:"hash_algorithm"`
+}
+
+type Journal struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+func OpenJournal(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	return &Journal{
+		file: f,
+		enc:  json.NewEncoder(f),
+	}, nil
+}
+
+func NewJournalEntry(source, target, hash string, algorithm config.HashAlgorithm) (JournalEntry, error) {
+	info, err := os.Lstat(target)
+	if err != nil {
+		return JournalEntry{}, fmt.Errorf("failed to stat target file: %w", err)
+	}
+	uid, gid := owner(info)
+	return JournalEntry{
+		Target:        target,
+		Source:        source,
+		Inode:         inode(info),
+		Size:          uint64(info.Size()),
+		Mode:          info.Mode(),
+		UID:           uid,
+		GID:           gid,
+		ModTime:       info.ModTime(),
+		AccessTime:    accessTime(info),
+		Hash:          hash,
+		HashAlgorithm: algorithm,
+	}, nil
+}
+
+// Record appends the entry to the journal and syncs it to disk, so that it
+// is durable before the target it describes is replaced.
+func (j *Journal) Record(entry JournalEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.enc.Encode(entry); err != nil {
+		return fmt.Errorf("failed to write journal entry: %w", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync journal: %w", err)
+	}
+	return nil
+}
+
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+func ReadJournal(path string) ([]JournalEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer f.Close()
+
+	entries := []JournalEntry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse journal line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	return entries, nil
+}
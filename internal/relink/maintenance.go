@@ -0,0 +1,209 @@
+package relink
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/USA-RedDragon/relink/internal/config"
+	"github.com/USA-RedDragon/relink/internal/relink/cache"
+)
+
+var ErrCacheNotPersistent = errors.New("cache is not persisted, use a sqlite or bolt cache with a cache path")
+
+func OpenCache(cacheType config.CacheType, path string) (cache.Cache, error) {
+	switch cacheType {
+	case config.CacheTypeMemory:
+		slog.Info("Using memory cache")
+		return cache.NewMemoryCache(), nil
+	case config.CacheTypeSQLite:
+		slog.Info("Using SQLite cache")
+		cc, err := cache.NewSQLiteCache(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create SQLite cache: %w", err)
+		}
+		return cc, nil
+	case config.CacheTypeBolt:
+		slog.Info("Using bolt cache")
+		cc, err := cache.NewBoltCache(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create bolt cache: %w", err)
+		}
+		return cc, nil
+	default:
+		return nil, fmt.Errorf("invalid cache type: %s", cacheType)
+	}
+}
+
+type CacheStats struct {
+	Entries int
+	// Hashes counts the distinct full hashes. Entries that only have a
+	// partial hash are not included.
+	Hashes int
+	// DuplicateGroups counts the full hashes shared by more than one entry.
+	DuplicateGroups int
+	Bytes           uint64
+	// DuplicateBytes is the size of every entry after the first in each
+	// duplicate group.
+	DuplicateBytes uint64
+}
+
+func GetCacheStats(cc cache.Cache) (CacheStats, error) {
+	stats := CacheStats{}
+	counts := map[string]int{}
+	err := cc.Range(func(_ string, entry cache.Entry) error {
+		stats.Entries++
+		stats.Bytes += uint64(entry.Size)
+		if entry.Hash == nil {
+			return nil
+		}
+		counts[string(entry.Hash)]++
+		switch counts[string(entry.Hash)] {
+		case 1:
+			stats.Hashes++
+		case 2:
+			stats.DuplicateGroups++
+			fallthrough
+		default:
+			stats.DuplicateBytes += uint64(entry.Size)
+		}
+		return nil
+	})
+	if err != nil {
+		return CacheStats{}, fmt.Errorf("failed to read cache: %w", err)
+	}
+	return stats, nil
+}
+
+// PruneCache deletes the entries for files that no longer exist or have
+// changed since they were hashed.
+func PruneCache(cc cache.Cache) (int, error) {
+	stale := []string{}
+	err := cc.Range(func(key string, entry cache.Entry) error {
+		// Caches from before multiple sources were keyed by relative path
+		if !filepath.IsAbs(key) {
+			stale = append(stale, key)
+			return nil
+		}
+		info, err := os.Lstat(key)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				stale = append(stale, key)
+				return nil
+			}
+			return fmt.Errorf("failed to stat source file: %w", err)
+		}
+		if !info.Mode().IsRegular() || !entry.Metadata.Equal(metadata(info)) {
+			stale = append(stale, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read cache: %w", err)
+	}
+
+	for _, key := range stale {
+		err := cc.Delete(key)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete cache entry: %w", err)
+		}
+	}
+	return len(stale), nil
+}
+
+// cacheRecord is the JSON Lines representation of a cache entry.
+type cacheRecord struct {
+	Key         string    `json:"key"`
+	Algorithm   string    `json:"algorithm"`
+	PartialSize int       `json:"partial_size"`
+	Partial     string    `json:"partial,omitempty"`
+	Hash        string    `json:"hash,omitempty"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mtime"`
+	ChangeTime  time.Time `json:"ctime"`
+	Inode       uint64    `json:"inode"`
+	Device      uint64    `json:"device"`
+}
+
+func ExportCache(cc cache.Cache, w io.Writer) (int, error) {
+	encoder := json.NewEncoder(w)
+	count := 0
+	err := cc.Range(func(key string, entry cache.Entry) error {
+		count++
+		return encoder.Encode(cacheRecord{
+			Key:         key,
+			Algorithm:   entry.Algorithm,
+			PartialSize: entry.PartialSize,
+			Partial:     hex.EncodeToString(entry.Partial),
+			Hash:        hex.EncodeToString(entry.Hash),
+			Size:        entry.Size,
+			ModTime:     entry.ModTime,
+			ChangeTime:  entry.ChangeTime,
+			Inode:       entry.Inode,
+			Device:      entry.Device,
+		})
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to export cache: %w", err)
+	}
+	return count, nil
+}
+
+func ImportCache(cc cache.Cache, r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	count := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record cacheRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return count, fmt.Errorf("failed to parse cache export line %d: %w", line, err)
+		}
+		partial, err := hex.DecodeString(record.Partial)
+		if err != nil {
+			return count, fmt.Errorf("failed to parse partial hash on line %d: %w", line, err)
+		}
+		hash, err := hex.DecodeString(record.Hash)
+		if err != nil {
+			return count, fmt.Errorf("failed to parse hash on line %d: %w", line, err)
+		}
+		entry := cache.Entry{
+			Metadata: cache.Metadata{
+				Size:       record.Size,
+				ModTime:    record.ModTime,
+				ChangeTime: record.ChangeTime,
+				Inode:      record.Inode,
+				Device:     record.Device,
+			},
+			Algorithm:   record.Algorithm,
+			PartialSize: record.PartialSize,
+		}
+		// Keep missing hashes nil, which marks them as not yet computed
+		if len(partial) > 0 {
+			entry.Partial = partial
+		}
+		if len(hash) > 0 {
+			entry.Hash = hash
+		}
+		err = cc.Put(record.Key, entry)
+		if err != nil {
+			return count, fmt.Errorf("failed to import cache entry: %w", err)
+		}
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return count, fmt.Errorf("failed to read cache export: %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,161 @@
+package relink_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/relink/internal/config"
+	"github.com/USA-RedDragon/relink/internal/relink"
+	"github.com/USA-RedDragon/relink/internal/relink/cache"
+)
+
+func TestGetCacheStats(t *testing.T) {
+	t.Parallel()
+
+	cc := cache.NewMemoryCache()
+	entries := map[string]cache.Entry{
+		"a": {Metadata: cache.Metadata{Size: 10}, Partial: []byte{1}, Hash: []byte{1}},
+		"b": {Metadata: cache.Metadata{Size: 10}, Partial: []byte{1}, Hash: []byte{1}},
+		"c": {Metadata: cache.Metadata{Size: 10}, Partial: []byte{1}, Hash: []byte{1}},
+		"d": {Metadata: cache.Metadata{Size: 20}, Partial: []byte{2}, Hash: []byte{2}},
+		"e": {Metadata: cache.Metadata{Size: 30}, Partial: []byte{3}},
+	}
+	for key, entry := range entries {
+		if err := cc.Put(key, entry); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	stats, err := relink.GetCacheStats(cc)
+	if err != nil {
+		t.Fatalf("GetCacheStats failed: %v", err)
+	}
+	want := relink.CacheStats{Entries: 5, Hashes: 2, DuplicateGroups: 1, Bytes: 80, DuplicateBytes: 20}
+	if stats != want {
+		t.Errorf("Expected %+v, got %+v", want, stats)
+	}
+}
+
+func TestPruneCache(t *testing.T) {
+	t.Parallel()
+	sourceDir, targetDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	for _, name := range []string{"unchanged.txt", "changed.txt", "deleted.txt"} {
+		err := os.WriteFile(filepath.Join(sourceDir, name), []byte("content"), 0600)
+		if err != nil {
+			t.Fatalf("Failed to create source file: %v", err)
+		}
+	}
+	err := os.WriteFile(filepath.Join(targetDir, "file.txt"), []byte("content"), 0600)
+	if err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &config.Config{
+		Source:        []string{sourceDir},
+		Target:        []string{targetDir},
+		HashJobs:      4,
+		BufferSize:    4096,
+		HashAlgorithm: config.HashAlgorithmBLAKE2b,
+		CacheType:     config.CacheTypeBolt,
+		CachePath:     filepath.Join(t.TempDir(), "cache.bolt"),
+	}
+	_, err = relink.BuildPlan(cfg)
+	if err != nil {
+		t.Fatalf("BuildPlan failed: %v", err)
+	}
+
+	modTime := time.Now().Add(time.Hour)
+	err = os.Chtimes(filepath.Join(sourceDir, "changed.txt"), modTime, modTime)
+	if err != nil {
+		t.Fatalf("Failed to set source file times: %v", err)
+	}
+	err = os.Remove(filepath.Join(sourceDir, "deleted.txt"))
+	if err != nil {
+		t.Fatalf("Failed to remove source file: %v", err)
+	}
+
+	cc, err := relink.OpenCache(cfg.CacheType, cfg.CachePath)
+	if err != nil {
+		t.Fatalf("OpenCache failed: %v", err)
+	}
+	defer cc.Close()
+
+	absSource, err := filepath.Abs(sourceDir)
+	if err != nil {
+		t.Fatalf("Failed to get absolute path: %v", err)
+	}
+	pruned, err := relink.PruneCache(cc)
+	if err != nil {
+		t.Fatalf("PruneCache failed: %v", err)
+	}
+	if pruned != 2 {
+		t.Errorf("Expected 2 entries to be pruned, got %d", pruned)
+	}
+	if _, ok, _ := cc.Get(filepath.Join(absSource, "unchanged.txt")); !ok {
+		t.Error("Expected the unchanged entry to be kept")
+	}
+	if _, ok, _ := cc.Get(filepath.Join(absSource, "deleted.txt")); ok {
+		t.Error("Expected the deleted entry to be pruned")
+	}
+}
+
+func TestExportImportCache(t *testing.T) {
+	t.Parallel()
+
+	source := cache.NewMemoryCache()
+	entries := map[string]cache.Entry{
+		"full.txt": {
+			Metadata:  cache.Metadata{Size: 10, ModTime: time.Unix(100, 5), ChangeTime: time.Unix(200, 0), Inode: 3, Device: 4},
+			Algorithm: "blake2b",
+			Partial:   []byte{1, 2},
+			Hash:      []byte{1, 2},
+		},
+		"partial.txt": {
+			Metadata:  cache.Metadata{Size: 20, ModTime: time.Unix(300, 0), ChangeTime: time.Unix(400, 0), Inode: 5, Device: 6},
+			Algorithm: "xxh3",
+			Partial:   []byte{3, 4},
+		},
+	}
+	for key, entry := range entries {
+		if err := source.Put(key, entry); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	exported, err := relink.ExportCache(source, &buf)
+	if err != nil {
+		t.Fatalf("ExportCache failed: %v", err)
+	}
+	if exported != len(entries) {
+		t.Errorf("Expected %d entries to be exported, got %d", len(entries), exported)
+	}
+
+	imported := cache.NewMemoryCache()
+	count, err := relink.ImportCache(imported, &buf)
+	if err != nil {
+		t.Fatalf("ImportCache failed: %v", err)
+	}
+	if count != len(entries) {
+		t.Errorf("Expected %d entries to be imported, got %d", len(entries), count)
+	}
+
+	for key, want := range entries {
+		got, ok, err := imported.Get(key)
+		if err != nil || !ok {
+			t.Fatalf("Expected %s to be imported: %v", key, err)
+		}
+		if !got.Metadata.Equal(want.Metadata) ||
+			got.Algorithm != want.Algorithm ||
+			!bytes.Equal(got.Partial, want.Partial) ||
+			!bytes.Equal(got.Hash, want.Hash) ||
+			(got.Hash == nil) != (want.Hash == nil) {
+			t.Errorf("Expected %s to be %+v, got %+v", key, want, got)
+		}
+	}
+}
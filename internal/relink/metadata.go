@@ -0,0 +1,163 @@
+package relink
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/USA-RedDragon/relink/internal/config"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	ErrMetadataMismatch = errors.New("target metadata differs from the source")
+	errMetadataSkipped  = errors.New("target skipped because its metadata would not be preserved")
+	errOwnerNotSet      = errors.New("failed to set file owner")
+)
+
+// aclPrefix is the namespace of the extended attributes holding POSIX ACLs.
+const aclPrefix = "system.posix_acl_"
+
+// MetadataDifferences lists the metadata a hardlink to source would change on
+// target: its owner, group, mode, ACLs and extended attributes. For a reflink,
+// source is the original target and target its clone.
+func MetadataDifferences(source, target string) ([]string, error) {
+	sourceInfo, err := os.Stat(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat source file: %w", err)
+	}
+	targetInfo, err := os.Lstat(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat target file: %w", err)
+	}
+
+	differences := []string{}
+	sourceUID, sourceGID := owner(sourceInfo)
+	targetUID, targetGID := owner(targetInfo)
+	if sourceUID != targetUID {
+		differences = append(differences, "owner")
+	}
+	if sourceGID != targetGID {
+		differences = append(differences, "group")
+	}
+	const modeBits = fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+	if sourceInfo.Mode()&modeBits != targetInfo.Mode()&modeBits {
+		differences = append(differences, "mode")
+	}
+
+	sourceACLs, sourceXattrs, err := xattrs(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read extended attributes of %s: %w", source, err)
+	}
+	targetACLs, targetXattrs, err := xattrs(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read extended attributes of %s: %w", target, err)
+	}
+	if !maps.EqualFunc(sourceACLs, targetACLs, bytes.Equal) {
+		differences = append(differences, "acl")
+	}
+	if !maps.EqualFunc(sourceXattrs, targetXattrs, bytes.Equal) {
+		differences = append(differences, "xattrs")
+	}
+
+	return differences, nil
+}
+
+// checkMetadata applies the metadata policy to a target whose metadata would
+// not be preserved by replacing it. Skipped targets return errMetadataSkipped.
+func checkMetadata(policy config.Metadata, source, target string, differences []string) error {
+	switch policy {
+	case config.MetadataRefuse:
+		return fmt.Errorf("%w: %s differs from %s in %s", ErrMetadataMismatch, target, source, strings.Join(differences, ", "))
+	case config.MetadataSkip:
+		slog.Warn("skipping file whose metadata would not be preserved", "source", source, "target", target, "differences", differences)
+		return errMetadataSkipped
+	case config.MetadataWarn:
+		fallthrough
+	default:
+		slog.Warn("replacing file whose metadata will not be preserved", "source", source, "target", target, "differences", differences)
+		return nil
+	}
+}
+
+// setMetadata gives path an owner, mode and timestamps. Changing the owner
+// needs privileges, so failing to do so doesn't stop the rest from being set
+// and is returned wrapped in errOwnerNotSet.
+func setMetadata(path string, uid, gid uint32, mode fs.FileMode, atime, mtime time.Time) error {
+	ownerErr := os.Lchown(path, int(uid), int(gid))
+	// chmod after chown, since changing the owner clears setuid and setgid
+	if err := os.Chmod(path, mode); err != nil {
+		return fmt.Errorf("failed to set mode: %w", err)
+	}
+	if err := os.Chtimes(path, atime, mtime); err != nil {
+		return fmt.Errorf("failed to set timestamps: %w", err)
+	}
+	if ownerErr != nil {
+		return fmt.Errorf("%w: %w", errOwnerNotSet, ownerErr)
+	}
+	return nil
+}
+
+// copyXattrs sets the extended attributes of source, including its ACLs, on
+// target. Some namespaces need privileges, so attributes that can't be set
+// are left for the caller to find as differences.
+func copyXattrs(source, target string) error {
+	acls, attrs, err := xattrs(source)
+	if err != nil {
+		return err
+	}
+	for name, value := range attrs {
+		_ = unix.Lsetxattr(target, name, value, 0)
+	}
+	for name, value := range acls {
+		_ = unix.Lsetxattr(target, name, value, 0)
+	}
+	return nil
+}
+
+// xattrs reads the extended attributes of path, split into the ones holding
+// ACLs and the rest. Filesystems without extended attributes have none.
+func xattrs(path string) (map[string][]byte, map[string][]byte, error) {
+	acls := map[string][]byte{}
+	attrs := map[string][]byte{}
+
+	size, err := unix.Llistxattr(path, nil)
+	if errors.Is(err, unix.ENOTSUP) {
+		return acls, attrs, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	list := make([]byte, size)
+	size, err = unix.Llistxattr(path, list)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for name := range strings.SplitSeq(string(list[:size]), "\x00") {
+		if name == "" {
+			continue
+		}
+		valueSize, err := unix.Lgetxattr(path, name, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		value := make([]byte, valueSize)
+		valueSize, err = unix.Lgetxattr(path, name, value)
+		if err != nil {
+			return nil, nil, err
+		}
+		if strings.HasPrefix(name, aclPrefix) {
+			acls[name] = value[:valueSize]
+		} else {
+			attrs[name] = value[:valueSize]
+		}
+	}
+	return acls, attrs, nil
+}
@@ -0,0 +1,111 @@
+package relink_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/USA-RedDragon/relink/internal/config"
+	"github.com/USA-RedDragon/relink/internal/relink"
+	"golang.org/x/sys/unix"
+)
+
+func TestMetadataDifferences(t *testing.T) {
+	t.Parallel()
+	tempDir, sourcePath, targetPath := setupTestFiles(t)
+	defer cleanupTestFiles(t, tempDir)
+
+	if err := os.WriteFile(targetPath, []byte("test content"), 0600); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	differences, err := relink.MetadataDifferences(sourcePath, targetPath)
+	if err != nil {
+		t.Fatalf("MetadataDifferences() failed: %v", err)
+	}
+	if len(differences) != 0 {
+		t.Errorf("MetadataDifferences() = %v, want none", differences)
+	}
+
+	if err := os.Chmod(targetPath, 0644); err != nil {
+		t.Fatalf("Failed to chmod target file: %v", err)
+	}
+	want := []string{"mode"}
+	err = unix.Lsetxattr(targetPath, "user.relink", []byte("test"), 0)
+	if err == nil {
+		want = append(want, "xattrs")
+	} else if !errors.Is(err, unix.ENOTSUP) {
+		t.Fatalf("Failed to set extended attribute: %v", err)
+	}
+
+	differences, err = relink.MetadataDifferences(sourcePath, targetPath)
+	if err != nil {
+		t.Fatalf("MetadataDifferences() failed: %v", err)
+	}
+	if !slices.Equal(differences, want) {
+		t.Errorf("MetadataDifferences() = %v, want %v", differences, want)
+	}
+}
+
+func TestApplyMetadataPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		policy  config.Metadata
+		linked  bool
+		wantErr error
+	}{
+		{config.MetadataWarn, true, nil},
+		{config.MetadataSkip, false, nil},
+		{config.MetadataRefuse, false, relink.ErrMetadataMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			t.Parallel()
+			sourceDir, targetDir, cleanup := setupTestDirs(t)
+			defer cleanup()
+
+			sourcePath := filepath.Join(sourceDir, "file.txt")
+			targetPath := filepath.Join(targetDir, "file.txt")
+			if err := os.WriteFile(sourcePath, []byte("content"), 0600); err != nil {
+				t.Fatalf("Failed to create source file: %v", err)
+			}
+			if err := os.WriteFile(targetPath, []byte("content"), 0600); err != nil {
+				t.Fatalf("Failed to create target file: %v", err)
+			}
+			if err := os.Chmod(targetPath, 0640); err != nil {
+				t.Fatalf("Failed to chmod target file: %v", err)
+			}
+
+			cfg := &config.Config{
+				Source:        []string{sourceDir},
+				Target:        []string{targetDir},
+				HashJobs:      4,
+				BufferSize:    4096,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+				LinkMode:      config.LinkModeHardlink,
+				Metadata:      tt.policy,
+			}
+			err := relink.Run(cfg)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Run() error = %v, want %v", err, tt.wantErr)
+			}
+
+			sourceInfo, err := os.Stat(sourcePath)
+			if err != nil {
+				t.Fatalf("Failed to stat source file: %v", err)
+			}
+			targetInfo, err := os.Stat(targetPath)
+			if err != nil {
+				t.Fatalf("Failed to stat target file: %v", err)
+			}
+			if os.SameFile(sourceInfo, targetInfo) != tt.linked {
+				t.Errorf("Target linked = %v, want %v", !tt.linked, tt.linked)
+			}
+		})
+	}
+}
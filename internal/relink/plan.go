@@ -0,0 +1,201 @@
+package relink
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/relink/internal/config"
+	"github.com/USA-RedDragon/relink/internal/utils"
+)
+
+const PlanVersion = 4
+
+var (
+	ErrUnsupportedPlanVersion = errors.New("unsupported plan version")
+	ErrPlanEntryChanged       = errors.New("file changed since the plan was created")
+)
+
+type PlanEntry struct {
+	Target        string    `json:"target"`
+	Source        string    `json:"source"`
+	Hash          string    `json:"hash"`
+	Size          uint64    `json:"size"`
+	ModTime       time.Time `json:"mtime"`
+	Inode         uint64    `json:"inode"`
+	SourceModTime time.Time `json:"source_mtime"`
+	SourceInode   uint64    `json:"source_inode"`
+	// LinkMode overrides the configured link mode, for files on a different
+	// device than their source
+	LinkMode config.LinkMode `json:"link_mode,omitempty"`
+}
+
+type Plan struct {
+	mu            sync.Mutex
+	Version       int                  `json:"version"`
+	Mode          config.Mode          `json:"mode"`
+	Sources       []string             `json:"sources"`
+	Targets       []string             `json:"targets"`
+	HashAlgorithm config.HashAlgorithm `json:"hash_algorithm"`
+	LinkMode      config.LinkMode      `json:"link_mode"`
+	SymlinkStyle  config.SymlinkStyle  `json:"symlink_style"`
+	Entries       []PlanEntry          `json:"entries"`
+}
+
+func NewPlan(sources, targets []string, algorithm config.HashAlgorithm) *Plan {
+	return &Plan{
+		Version:       PlanVersion,
+		Mode:          config.ModeTarget,
+		Sources:       sources,
+		Targets:       targets,
+		HashAlgorithm: algorithm,
+		Entries:       []PlanEntry{},
+	}
+}
+
+func ReadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+	plan := &Plan{}
+	if err := json.Unmarshal(data, plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan: %w", err)
+	}
+	if plan.Version != PlanVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedPlanVersion, plan.Version)
+	}
+	return plan, nil
+}
+
+func (p *Plan) Write(path string) error {
+	p.mu.Lock()
+	slices.SortFunc(p.Entries, func(a, b PlanEntry) int {
+		return strings.Compare(a.Target, b.Target)
+	})
+	data, err := json.MarshalIndent(p, "", "  ")
+	p.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode plan: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+	return nil
+}
+
+func (p *Plan) Add(entry PlanEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Entries = append(p.Entries, entry)
+}
+
+func (p *Plan) TotalSize() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	total := uint64(0)
+	for _, entry := range p.Entries {
+		total += entry.Size
+	}
+	return total
+}
+
+// TargetStats summarizes the entries planned for one target directory.
+type TargetStats struct {
+	Target string
+	Files  int
+	Bytes  uint64
+}
+
+// TargetStats returns the number and size of the entries in each of the
+// plan's targets, in the order the targets were given. An entry is counted
+// against the first target that contains it.
+func (p *Plan) TargetStats() []TargetStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := make([]TargetStats, len(p.Targets))
+	for i, target := range p.Targets {
+		stats[i].Target = target
+	}
+	for _, entry := range p.Entries {
+		for i, target := range p.Targets {
+			if utils.IsWithin(target, entry.Target) {
+				stats[i].Files++
+				stats[i].Bytes += entry.Size
+				break
+			}
+		}
+	}
+	return stats
+}
+
+func (p *Plan) Print(w io.Writer) error {
+	p.mu.Lock()
+	entries := slices.Clone(p.Entries)
+	p.mu.Unlock()
+
+	slices.SortFunc(entries, func(a, b PlanEntry) int {
+		return strings.Compare(a.Target, b.Target)
+	})
+
+	for _, entry := range entries {
+		details := utils.HumanReadableSize(entry.Size)
+		if entry.LinkMode != "" {
+			details += ", " + string(entry.LinkMode)
+		}
+		if _, err := fmt.Fprintf(w, "%s -> %s (%s)\n", entry.Target, entry.Source, details); err != nil {
+			return err
+		}
+	}
+
+	if len(p.Targets) > 1 {
+		for _, stats := range p.TargetStats() {
+			if _, err := fmt.Fprintf(w, "%s: %d files would be replaced, %s would be reclaimed\n", stats.Target, stats.Files, utils.HumanReadableSize(stats.Bytes)); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "%d files would be replaced, %s would be reclaimed\n", len(entries), utils.HumanReadableSize(p.TotalSize()))
+	return err
+}
+
+// Validate checks that neither the target nor the source has been modified
+// or replaced since the entry was planned.
+func (e PlanEntry) Validate() error {
+	targetInfo, err := os.Lstat(e.Target)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: %s no longer exists", ErrPlanEntryChanged, e.Target)
+		}
+		return fmt.Errorf("failed to stat target file: %w", err)
+	}
+	if !targetInfo.Mode().IsRegular() ||
+		uint64(targetInfo.Size()) != e.Size ||
+		!targetInfo.ModTime().Equal(e.ModTime) ||
+		inode(targetInfo) != e.Inode {
+		return fmt.Errorf("%w: %s", ErrPlanEntryChanged, e.Target)
+	}
+
+	sourceInfo, err := os.Stat(e.Source)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: %s no longer exists", ErrPlanEntryChanged, e.Source)
+		}
+		return fmt.Errorf("failed to stat source file: %w", err)
+	}
+	if uint64(sourceInfo.Size()) != e.Size ||
+		!sourceInfo.ModTime().Equal(e.SourceModTime) ||
+		inode(sourceInfo) != e.SourceInode {
+		return fmt.Errorf("%w: %s", ErrPlanEntryChanged, e.Source)
+	}
+
+	return nil
+}
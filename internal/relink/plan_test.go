@@ -0,0 +1,167 @@
+package relink_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/USA-RedDragon/relink/internal/config"
+	"github.com/USA-RedDragon/relink/internal/relink"
+)
+
+func TestPlan(t *testing.T) {
+	t.Parallel()
+
+	plan := &relink.Plan{}
+	plan.Add(relink.PlanEntry{Target: "/target/b.txt", Source: "/source/b.txt", Size: 2048})
+	plan.Add(relink.PlanEntry{Target: "/target/a.txt", Source: "/source/a.txt", Size: 1024})
+
+	if plan.TotalSize() != 3072 {
+		t.Errorf("TotalSize() = %d, want %d", plan.TotalSize(), 3072)
+	}
+
+	var buf bytes.Buffer
+	if err := plan.Print(&buf); err != nil {
+		t.Fatalf("Print() failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Print() wrote %d lines, want %d", len(lines), 3)
+	}
+	if lines[0] != "/target/a.txt -> /source/a.txt (1.0 KiB)" {
+		t.Errorf("Print() first line = %q", lines[0])
+	}
+	if lines[1] != "/target/b.txt -> /source/b.txt (2.0 KiB)" {
+		t.Errorf("Print() second line = %q", lines[1])
+	}
+	if lines[2] != "2 files would be replaced, 3.0 KiB would be reclaimed" {
+		t.Errorf("Print() summary line = %q", lines[2])
+	}
+}
+
+func TestPlanTargetStats(t *testing.T) {
+	t.Parallel()
+
+	plan := relink.NewPlan([]string{"/source"}, []string{"/downloads", "/downloads-old"}, config.HashAlgorithmBLAKE2b)
+	plan.Add(relink.PlanEntry{Target: "/downloads/a.txt", Source: "/source/a.txt", Size: 1024})
+	plan.Add(relink.PlanEntry{Target: "/downloads/sub/b.txt", Source: "/source/b.txt", Size: 1024})
+	plan.Add(relink.PlanEntry{Target: "/downloads-old/c.txt", Source: "/source/c.txt", Size: 2048})
+
+	stats := plan.TargetStats()
+	want := []relink.TargetStats{
+		{Target: "/downloads", Files: 2, Bytes: 2048},
+		{Target: "/downloads-old", Files: 1, Bytes: 2048},
+	}
+	if len(stats) != len(want) {
+		t.Fatalf("TargetStats() returned %d targets, want %d", len(stats), len(want))
+	}
+	for i := range want {
+		if stats[i] != want[i] {
+			t.Errorf("TargetStats()[%d] = %+v, want %+v", i, stats[i], want[i])
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := plan.Print(&buf); err != nil {
+		t.Fatalf("Print() failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("Print() wrote %d lines, want %d", len(lines), 6)
+	}
+	if lines[3] != "/downloads: 2 files would be replaced, 2.0 KiB would be reclaimed" {
+		t.Errorf("Print() first target line = %q", lines[3])
+	}
+	if lines[4] != "/downloads-old: 1 files would be replaced, 2.0 KiB would be reclaimed" {
+		t.Errorf("Print() second target line = %q", lines[4])
+	}
+}
+
+func TestPlanWriteRead(t *testing.T) {
+	t.Parallel()
+	sourceDir, targetDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	sourcePath := filepath.Join(sourceDir, "file.txt")
+	targetPath := filepath.Join(targetDir, "file.txt")
+	if err := os.WriteFile(sourcePath, []byte("content"), 0600); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetPath, []byte("content"), 0600); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &config.Config{
+		Source:        []string{sourceDir},
+		Target:        []string{targetDir},
+		HashJobs:      4,
+		BufferSize:    4096,
+		CacheType:     config.CacheTypeMemory,
+		HashAlgorithm: config.HashAlgorithmBLAKE2b,
+		LinkMode:      config.LinkModeSymlink,
+		SymlinkStyle:  config.SymlinkStyleAbsolute,
+	}
+	plan, err := relink.BuildPlan(cfg)
+	if err != nil {
+		t.Fatalf("BuildPlan() failed: %v", err)
+	}
+
+	planPath := filepath.Join(t.TempDir(), "plan.json")
+	if err := plan.Write(planPath); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+
+	read, err := relink.ReadPlan(planPath)
+	if err != nil {
+		t.Fatalf("ReadPlan() failed: %v", err)
+	}
+	if len(read.Entries) != 1 {
+		t.Fatalf("ReadPlan() returned %d entries, want %d", len(read.Entries), 1)
+	}
+	if read.LinkMode != cfg.LinkMode || read.SymlinkStyle != cfg.SymlinkStyle {
+		t.Errorf("ReadPlan() link mode = %s %s, want %s %s", read.LinkMode, read.SymlinkStyle, cfg.LinkMode, cfg.SymlinkStyle)
+	}
+	if err := read.Entries[0].Validate(); err != nil {
+		t.Errorf("Validate() unexpected error = %v", err)
+	}
+
+	if err := os.WriteFile(targetPath, []byte("changed content"), 0600); err != nil {
+		t.Fatalf("Failed to modify target file: %v", err)
+	}
+	if err := read.Entries[0].Validate(); !errors.Is(err, relink.ErrPlanEntryChanged) {
+		t.Errorf("Validate() error = %v, want %v", err, relink.ErrPlanEntryChanged)
+	}
+
+	if err := relink.Apply(cfg, read); err != nil {
+		t.Fatalf("Apply() failed: %v", err)
+	}
+	sourceInfo, err := os.Stat(sourcePath)
+	if err != nil {
+		t.Fatalf("Failed to stat source file: %v", err)
+	}
+	targetInfo, err := os.Stat(targetPath)
+	if err != nil {
+		t.Fatalf("Failed to stat target file: %v", err)
+	}
+	if os.SameFile(sourceInfo, targetInfo) {
+		t.Error("Apply() should skip files that changed since planning")
+	}
+}
+
+func TestReadPlanUnsupportedVersion(t *testing.T) {
+	t.Parallel()
+
+	planPath := filepath.Join(t.TempDir(), "plan.json")
+	if err := os.WriteFile(planPath, []byte(`{"version": 999, "entries": []}`), 0600); err != nil {
+		t.Fatalf("Failed to write plan: %v", err)
+	}
+
+	_, err := relink.ReadPlan(planPath)
+	if !errors.Is(err, relink.ErrUnsupportedPlanVersion) {
+		t.Errorf("ReadPlan() error = %v, want %v", err, relink.ErrUnsupportedPlanVersion)
+	}
+}
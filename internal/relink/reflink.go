@@ -0,0 +1,98 @@
+package relink
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+var ErrReflinkNotSupported = errors.New("these files cannot share extents")
+
+// AtomicReflink replaces target with a copy-on-write clone of source. The
+// clone shares its extents with source but is an independent file, so it
+// keeps the owner, mode, timestamps and extended attributes of the target it
+// replaces. Whatever metadata couldn't be kept is passed to check, if not
+// nil, and target is left alone if check returns an error.
+func AtomicReflink(source, target string, check func(differences []string) error) error {
+	info, err := os.Lstat(target)
+	if err != nil {
+		return fmt.Errorf("failed to stat target file: %w", err)
+	}
+
+	tempName, err := GetSafeTempFile(filepath.Dir(target), ".relink-"+filepath.Base(target))
+	if err != nil {
+		return fmt.Errorf("failed to create temp file for %s: %w", target, err)
+	}
+	defer os.Remove(tempName)
+
+	if err = cloneFile(source, tempName); err != nil {
+		return fmt.Errorf("failed to create reflink from %s to %s: %w", source, tempName, err)
+	}
+
+	// A failure to set the owner shows up as a difference below
+	uid, gid := owner(info)
+	err = setMetadata(tempName, uid, gid, info.Mode(), accessTime(info), info.ModTime())
+	if err != nil && !errors.Is(err, errOwnerNotSet) {
+		return fmt.Errorf("failed to preserve metadata of %s: %w", target, err)
+	}
+	// Set after the owner, since changing it clears file capabilities
+	err = copyXattrs(target, tempName)
+	if err != nil {
+		return fmt.Errorf("failed to preserve extended attributes of %s: %w", target, err)
+	}
+
+	if check != nil {
+		differences, err := MetadataDifferences(target, tempName)
+		if err != nil {
+			return err
+		}
+		if len(differences) > 0 {
+			err = check(differences)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = os.Rename(tempName, target); err != nil {
+		return fmt.Errorf("failed to move reflink from %s to %s: %w", tempName, target, err)
+	}
+	return nil
+}
+
+func cloneFile(source, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	err = unix.IoctlFileClone(int(out.Fd()), int(in.Fd()))
+	if err != nil {
+		return reflinkError(err)
+	}
+	return out.Close()
+}
+
+// reflinkError marks the errors the kernel returns when the filesystem can't
+// share extents between the two files, as opposed to an I/O failure.
+func reflinkError(err error) error {
+	switch {
+	case errors.Is(err, unix.EOPNOTSUPP),
+		errors.Is(err, unix.ENOTTY),
+		errors.Is(err, unix.EXDEV),
+		errors.Is(err, unix.EINVAL):
+		return fmt.Errorf("%w: %w", ErrReflinkNotSupported, err)
+	default:
+		return err
+	}
+}
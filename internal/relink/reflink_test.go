@@ -0,0 +1,71 @@
+package relink_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/relink/internal/relink"
+)
+
+func TestAtomicReflink_Success(t *testing.T) {
+	t.Parallel()
+	tempDir, sourcePath, targetPath := setupTestFiles(t)
+	defer cleanupTestFiles(t, tempDir)
+
+	if err := os.WriteFile(targetPath, []byte("test content"), 0640); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(targetPath, modTime, modTime); err != nil {
+		t.Fatalf("Failed to set target timestamps: %v", err)
+	}
+
+	err := relink.AtomicReflink(sourcePath, targetPath, nil)
+	if errors.Is(err, relink.ErrReflinkNotSupported) {
+		t.Skipf("Filesystem does not support reflinks: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("AtomicReflink failed: %v", err)
+	}
+
+	sourceInfo, err := os.Stat(sourcePath)
+	if err != nil {
+		t.Fatalf("Failed to stat source file: %v", err)
+	}
+	targetInfo, err := os.Stat(targetPath)
+	if err != nil {
+		t.Fatalf("Failed to stat target file: %v", err)
+	}
+
+	if os.SameFile(sourceInfo, targetInfo) {
+		t.Error("Reflinked target should be an independent file")
+	}
+	if targetInfo.Mode().Perm() != 0640 {
+		t.Errorf("Target mode = %v, want %v", targetInfo.Mode().Perm(), os.FileMode(0640))
+	}
+	if !targetInfo.ModTime().Equal(modTime) {
+		t.Errorf("Target mtime = %v, want %v", targetInfo.ModTime(), modTime)
+	}
+
+	content, err := os.ReadFile(targetPath)
+	if err != nil {
+		t.Fatalf("Failed to read target file: %v", err)
+	}
+	if !bytes.Equal(content, []byte("test content")) {
+		t.Errorf("Target content = %q, want %q", content, "test content")
+	}
+}
+
+func TestAtomicReflink_TargetDoesNotExist(t *testing.T) {
+	t.Parallel()
+	tempDir, sourcePath, targetPath := setupTestFiles(t)
+	defer cleanupTestFiles(t, tempDir)
+
+	err := relink.AtomicReflink(sourcePath, targetPath, nil)
+	if err == nil {
+		t.Error("Expected error when target does not exist, got nil")
+	}
+}
@@ -1,10 +1,12 @@
 package relink
 
 import (
+	"encoding/hex"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync/atomic"
 	"time"
 
@@ -12,178 +14,330 @@ import (
 	"github.com/USA-RedDragon/relink/internal/relink/cache"
 	"github.com/USA-RedDragon/relink/internal/utils"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
 )
 
 func Run(cfg *config.Config) error {
-	absSource, err := filepath.Abs(cfg.Source)
+	plan, err := BuildPlan(cfg)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path for source: %w", err)
+		return err
+	}
+
+	if cfg.DryRun {
+		slog.Info("Dry run completed, no files were changed")
+		return plan.Print(os.Stdout)
 	}
-	absTarget, err := filepath.Abs(cfg.Target)
+
+	err = Apply(cfg, plan)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path for target: %w", err)
+		return err
 	}
 
-	grp := errgroup.Group{}
-	grp.SetLimit(cfg.HashJobs)
+	slog.Info("Hashing and hardlinking completed")
 
-	var cc cache.Cache
+	return nil
+}
 
-	switch cfg.CacheType {
-	case config.CacheTypeMemory:
-		slog.Info("Using memory cache")
-		cc = cache.NewMemoryCache()
-	case config.CacheTypeSQLite:
-		slog.Info("Using SQLite cache")
-		cc, err = cache.NewSQLiteCache(cfg.CachePath)
+func BuildPlan(cfg *config.Config) (*Plan, error) {
+	absSources := make([]string, 0, len(cfg.Source))
+	for _, source := range cfg.Source {
+		absSource, err := filepath.Abs(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute path for source: %w", err)
+		}
+		absSources = append(absSources, absSource)
+	}
+	absTargets := make([]string, 0, len(cfg.Target))
+	for _, target := range cfg.Target {
+		absTarget, err := filepath.Abs(target)
 		if err != nil {
-			return fmt.Errorf("failed to create SQLite cache: %w", err)
+			return nil, fmt.Errorf("failed to get absolute path for target: %w", err)
 		}
-		defer cc.Close()
-	default:
-		return fmt.Errorf("invalid cache type: %s", cfg.CacheType)
+		absTargets = append(absTargets, absTarget)
 	}
 
-	slog.Info("Walking source files")
+	minSize, err := utils.ParseSize(cfg.MinSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid minimum file size: %w", err)
+	}
+	maxSize, err := utils.ParseSize(cfg.MaxSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid maximum file size: %w", err)
+	}
+	sourceFilter, err := NewFilter(cfg.SourceInclude, cfg.SourceExclude)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source filter: %w", err)
+	}
+	targetFilter, err := NewFilter(cfg.TargetInclude, cfg.TargetExclude)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target filter: %w", err)
+	}
+	sourceFilter.MinSize, sourceFilter.MaxSize = minSize, maxSize
+	targetFilter.MinSize, targetFilter.MaxSize = minSize, maxSize
+
+	cc, err := OpenCache(cfg.CacheType, cfg.CachePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := cc.Close(); err != nil {
+			slog.Warn("failed to close cache", "error", err)
+		}
+	}()
+
+	// Cache keys are absolute paths, so files from every source share one
+	// cache. priorities maps each walked source file to the index of the
+	// first source it was found in, which is also its priority.
+	sourceFiles := []FileInfo{}
+	priorities := map[string]int{}
+	for i, absSource := range absSources {
+		slog.Info("Walking source files", "source", absSource)
+		files, err := collect(absSource, sourceFilter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to walk source: %w", err)
+		}
+		for _, file := range files {
+			// Nested sources walk the same files more than once
+			if _, ok := priorities[file.Path]; ok {
+				continue
+			}
+			priorities[file.Path] = i
+			sourceFiles = append(sourceFiles, file)
+		}
+	}
+
+	if cfg.Mode == config.ModeSelf {
+		return buildSelfPlan(cfg, cc, absSources, sourceFiles)
+	}
+
+	// Every target is matched against the same source cache in a single
+	// target phase.
+	targetFiles := []FileInfo{}
+	walkedTargets := map[string]struct{}{}
+	for _, absTarget := range absTargets {
+		slog.Info("Walking target files", "target", absTarget)
+		files, err := collect(absTarget, targetFilter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to walk target: %w", err)
+		}
+		for _, file := range files {
+			// Nested targets walk the same files more than once
+			if _, ok := walkedTargets[file.Path]; ok {
+				continue
+			}
+			walkedTargets[file.Path] = struct{}{}
+			targetFiles = append(targetFiles, file)
+		}
+	}
+
+	// A file can only match files of the same size, so anything with a
+	// size unique to its own tree never needs to be hashed.
+	sourceSizes := sizeIndex(sourceFiles)
+	targetSizes := sizeIndex(targetFiles)
+	walkedSource, walkedTarget := len(sourceFiles), len(targetFiles)
+	sourceFiles = filterBySize(sourceFiles, targetSizes)
+	targetFiles = filterBySize(targetFiles, sourceSizes)
+	slog.Info("Filtered files by size", "source", len(sourceFiles), "sourceSkipped", walkedSource-len(sourceFiles), "target", len(targetFiles), "targetSkipped", walkedTarget-len(targetFiles))
+
+	err = hashSources(cfg, cc, sourceFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	grp := errgroup.Group{}
+	grp.SetLimit(cfg.HashJobs)
 
 	totalFiles := 0
 	totalSize := uint64(0)
 	var completedFiles atomic.Uint64
 	var completedSize atomic.Uint64
 
-	for file := range Walk(absSource) {
+	plan := NewPlan(absSources, absTargets, cfg.HashAlgorithm)
+	plan.LinkMode = cfg.LinkMode
+	plan.SymlinkStyle = cfg.SymlinkStyle
+	var sourceHashes singleflight.Group
+
+	for _, file := range targetFiles {
 		totalFiles++
 		fileSize := file.Info.Size()
 		totalSize += uint64(fileSize)
 		go func() {
 			grp.Go(func() error {
 				defer func() { completedFiles.Add(1) }()
-				relative, err := filepath.Rel(absSource, file.Path)
+				entry, err := digest(file, cfg, &completedSize)
 				if err != nil {
-					return fmt.Errorf("failed to get relative path: %w", err)
+					slog.Error("failed to hash file", "file", file.Path, "error", err)
+					return err
 				}
 
-				// Check if the file is already in the cache
-				exists, err := cc.Exists(relative)
+				candidates, err := cc.GetByPartialHash(entry.Partial)
 				if err != nil {
-					return fmt.Errorf("failed to check if file exists in cache: %w", err)
+					return fmt.Errorf("failed to get partial hash from cache: %w", err)
 				}
-				if exists {
-					completedSize.Add(uint64(fileSize))
+				// Entries for files that weren't walked this run may be
+				// stale or belong to other sources
+				candidates = slices.DeleteFunc(candidates, func(candidate string) bool {
+					_, ok := priorities[candidate]
+					return !ok
+				})
+				if len(candidates) == 0 {
 					return nil
 				}
 
-				readBytesChan := make(chan uint64)
-				wg := errgroup.Group{}
-				wg.Go(func() error {
-					hash, err := HashFile(file.Path, cfg.BufferSize, readBytesChan)
+				// The partial hashes collide, so the full hashes of the
+				// target and every candidate are needed to tell them apart.
+				hash := entry.Hash
+				if hash == nil {
+					hash, err = HashFile(file.Path, cfg.HashAlgorithm, cfg.BufferSize, nil)
+					if err != nil {
+						slog.Error("failed to hash file", "file", file.Path, "error", err)
+						return err
+					}
+				}
+				for _, candidate := range candidates {
+					err := ensureFullHash(cc, &sourceHashes, candidate, cfg)
 					if err != nil {
-						slog.Error("failed to hash file", "file", file, "error", err)
 						return err
 					}
+				}
 
-					close(readBytesChan)
+				matches, err := cc.GetByHash(hash)
+				if err != nil {
+					return fmt.Errorf("failed to get hash from cache: %w", err)
+				}
+				sourceFile, ok := preferredSource(matches, priorities)
+				if !ok {
+					return nil
+				}
 
-					return cc.Put(relative, hash)
+				sourceInfo, err := os.Stat(sourceFile)
+				if err != nil {
+					return fmt.Errorf("failed to stat source file: %w", err)
+				}
+				if os.SameFile(sourceInfo, file.Info) {
+					slog.Debug("file is already hardlinked to source", "source", sourceFile, "target", file.Path)
+					return nil
+				}
+				linkMode, ok := crossDeviceLinkMode(cfg, sourceFile, file.Path, sourceInfo, file.Info)
+				if !ok {
+					return nil
+				}
+				shared, err := alreadyShared(cfg, linkMode, sourceFile, file.Path)
+				if err != nil {
+					return err
+				}
+				if shared {
+					slog.Debug("file already shares its extents with source", "source", sourceFile, "target", file.Path)
+					return nil
+				}
+
+				plan.Add(PlanEntry{
+					Target:        file.Path,
+					Source:        sourceFile,
+					Hash:          hex.EncodeToString(hash),
+					Size:          uint64(fileSize),
+					ModTime:       file.Info.ModTime(),
+					Inode:         inode(file.Info),
+					SourceModTime: sourceInfo.ModTime(),
+					SourceInode:   inode(sourceInfo),
+					LinkMode:      linkMode,
 				})
 
-				for {
-					select {
-					case readBytes, ok := <-readBytesChan:
-						if !ok {
-							return wg.Wait()
-						}
-						completedSize.Add(readBytes)
-					}
-				}
+				return nil
 			})
 		}()
 	}
 
 	for int(completedFiles.Load()) < totalFiles {
-		slog.Info("Hashing source files", "completed", int(completedFiles.Load()), "total", totalFiles, "completedSize", utils.HumanReadableSize(completedSize.Load()), "totalSize", utils.HumanReadableSize(totalSize))
+		slog.Info("Hashing target files", "completed", int(completedFiles.Load()), "total", totalFiles, "completedSize", utils.HumanReadableSize(completedSize.Load()), "totalSize", utils.HumanReadableSize(totalSize))
 		time.Sleep(time.Second)
 	}
-	slog.Info("Hashing source files", "completed", int(completedFiles.Load()), "total", totalFiles, "completedSize", utils.HumanReadableSize(completedSize.Load()), "totalSize", utils.HumanReadableSize(totalSize))
+	slog.Info("Hashing target files", "completed", int(completedFiles.Load()), "total", totalFiles, "completedSize", utils.HumanReadableSize(completedSize.Load()), "totalSize", utils.HumanReadableSize(totalSize))
 
 	err = grp.Wait()
 	if err != nil {
-		slog.Error("failed to process files", "error", err)
-		return err
+		slog.Error("failed to process target files", "error", err)
+		return nil, err
 	}
 
-	slog.Info("Walking target files")
-
-	totalFiles = 0
-	totalSize = 0
-	completedFiles.Store(0)
-	completedSize.Store(0)
+	return plan, nil
+}
 
-	for file := range Walk(absTarget) {
-		totalFiles++
-		if file.Info.Mode()&os.ModeSymlink != 0 {
-			slog.Debug("skipping symlink", "file", file)
+// preferredSource picks the match from the highest priority source, breaking
+// ties by path so repeated runs pick the same file. Matches that weren't
+// walked this run are ignored.
+func preferredSource(matches []string, priorities map[string]int) (string, bool) {
+	best := ""
+	bestPriority := -1
+	for _, match := range matches {
+		priority, ok := priorities[match]
+		if !ok {
 			continue
 		}
+		if bestPriority == -1 || priority < bestPriority || (priority == bestPriority && match < best) {
+			best = match
+			bestPriority = priority
+		}
+	}
+	return best, bestPriority != -1
+}
+
+// hashSources makes sure the cache holds an up to date partial hash for every
+// source file.
+func hashSources(cfg *config.Config, cc cache.Cache, sourceFiles []FileInfo) error {
+	grp := errgroup.Group{}
+	grp.SetLimit(cfg.HashJobs)
+
+	totalFiles := 0
+	totalSize := uint64(0)
+	var completedFiles atomic.Uint64
+	var completedSize atomic.Uint64
+
+	for _, file := range sourceFiles {
+		totalFiles++
 		fileSize := file.Info.Size()
 		totalSize += uint64(fileSize)
 		go func() {
 			grp.Go(func() error {
 				defer func() { completedFiles.Add(1) }()
-				readBytesChan := make(chan uint64)
-				wg := errgroup.Group{}
-				wg.Go(func() error {
-					hash, err := HashFile(file.Path, cfg.BufferSize, readBytesChan)
-					if err != nil {
-						slog.Error("failed to hash file", "file", file, "error", err)
-						return err
-					}
-					close(readBytesChan)
-
-					sourceRelative, err := cc.GetByHash(hash)
-					if err != nil {
-						return fmt.Errorf("failed to get hash from cache: %w", err)
-					}
-					if sourceRelative == "" {
-						return nil
-					}
-
-					sourceFile := filepath.Join(absSource, sourceRelative)
-					err = AtomicLink(sourceFile, file.Path)
-					if err != nil {
-						return fmt.Errorf("failed to create hardlink: %w", err)
-					}
-					slog.Info("file hashes match, hardlink created", "source", sourceFile, "target", file.Path)
 
+				// Reuse the cached hash only if it was computed with the same
+				// algorithm and block size from the file as it is now
+				cached, exists, err := cc.Get(file.Path)
+				if err != nil {
+					return fmt.Errorf("failed to check if file exists in cache: %w", err)
+				}
+				if exists &&
+					cached.Partial != nil &&
+					cached.Algorithm == string(cfg.HashAlgorithm) &&
+					cached.PartialSize == cfg.PartialHashSize &&
+					cached.Metadata.Equal(metadata(file.Info)) {
+					completedSize.Add(uint64(fileSize))
 					return nil
-				})
+				}
 
-				for {
-					select {
-					case readBytes, ok := <-readBytesChan:
-						if !ok {
-							return wg.Wait()
-						}
-						completedSize.Add(readBytes)
-					}
+				entry, err := digest(file, cfg, &completedSize)
+				if err != nil {
+					slog.Error("failed to hash file", "file", file.Path, "error", err)
+					return err
 				}
+
+				return cc.Put(file.Path, entry)
 			})
 		}()
 	}
 
 	for int(completedFiles.Load()) < totalFiles {
-		slog.Info("Hashing target files", "completed", int(completedFiles.Load()), "total", totalFiles, "completedSize", utils.HumanReadableSize(completedSize.Load()), "totalSize", utils.HumanReadableSize(totalSize))
+		slog.Info("Hashing source files", "completed", int(completedFiles.Load()), "total", totalFiles, "completedSize", utils.HumanReadableSize(completedSize.Load()), "totalSize", utils.HumanReadableSize(totalSize))
 		time.Sleep(time.Second)
 	}
-	slog.Info("Hashing target files", "completed", int(completedFiles.Load()), "total", totalFiles, "completedSize", utils.HumanReadableSize(completedSize.Load()), "totalSize", utils.HumanReadableSize(totalSize))
+	slog.Info("Hashing source files", "completed", int(completedFiles.Load()), "total", totalFiles, "completedSize", utils.HumanReadableSize(completedSize.Load()), "totalSize", utils.HumanReadableSize(totalSize))
 
-	err = grp.Wait()
+	err := grp.Wait()
 	if err != nil {
-		slog.Error("failed to process target files", "error", err)
+		slog.Error("failed to process files", "error", err)
 		return err
 	}
 
-	slog.Info("Hashing and hardlinking completed")
-
 	return nil
 }
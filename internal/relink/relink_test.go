@@ -2,8 +2,11 @@ package relink_test
 
 import (
 	"os"
+	"os/exec"
 	"path/filepath"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/USA-RedDragon/relink/internal/config"
 	"github.com/USA-RedDragon/relink/internal/relink"
@@ -73,11 +76,13 @@ func TestRun(t *testing.T) {
 
 		// Run relink
 		cfg := &config.Config{
-			Source:     sourceDir,
-			Target:     targetDir,
-			HashJobs:   4,
-			CacheType:  config.CacheTypeMemory,
-			BufferSize: 4096,
+			Source:        []string{sourceDir},
+			Target:        []string{targetDir},
+			HashJobs:      4,
+			CacheType:     config.CacheTypeMemory,
+			HashAlgorithm: config.HashAlgorithmBLAKE2b,
+			BufferSize:    4096,
+			Verify:        true,
 		}
 		err := relink.Run(cfg)
 		if err != nil {
@@ -123,11 +128,12 @@ func TestRun(t *testing.T) {
 
 		// Run relink
 		cfg := &config.Config{
-			Source:     sourceDir,
-			Target:     targetDir,
-			HashJobs:   4,
-			BufferSize: 4096,
-			CacheType:  config.CacheTypeMemory,
+			Source:        []string{sourceDir},
+			Target:        []string{targetDir},
+			HashJobs:      4,
+			BufferSize:    4096,
+			CacheType:     config.CacheTypeMemory,
+			HashAlgorithm: config.HashAlgorithmBLAKE2b,
 		}
 		err = relink.Run(cfg)
 		if err != nil {
@@ -147,4 +153,693 @@ func TestRun(t *testing.T) {
 			t.Error("Files should not be hard linked due to different content")
 		}
 	})
+	t.Run("does not link files in dry run", func(t *testing.T) {
+		t.Parallel()
+		sourceDir, targetDir, cleanup := setupTestDirs(t)
+		defer cleanup()
+
+		sourcePath := filepath.Join(sourceDir, "file.txt")
+		targetPath := filepath.Join(targetDir, "file.txt")
+
+		err := os.WriteFile(sourcePath, []byte("same content"), 0600)
+		if err != nil {
+			t.Fatalf("Failed to create source file: %v", err)
+		}
+		err = os.WriteFile(targetPath, []byte("same content"), 0600)
+		if err != nil {
+			t.Fatalf("Failed to create target file: %v", err)
+		}
+
+		cfg := &config.Config{
+			Source:        []string{sourceDir},
+			Target:        []string{targetDir},
+			HashJobs:      4,
+			BufferSize:    4096,
+			CacheType:     config.CacheTypeMemory,
+			HashAlgorithm: config.HashAlgorithmBLAKE2b,
+			DryRun:        true,
+		}
+		err = relink.Run(cfg)
+		if err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+
+		sourceInfo, err := os.Stat(sourcePath)
+		if err != nil {
+			t.Fatalf("Failed to stat source file: %v", err)
+		}
+		targetInfo, err := os.Stat(targetPath)
+		if err != nil {
+			t.Fatalf("Failed to stat target file: %v", err)
+		}
+
+		if os.SameFile(sourceInfo, targetInfo) {
+			t.Error("Files should not be hard linked in a dry run")
+		}
+	})
+	t.Run("skips files that are already hard linked", func(t *testing.T) {
+		t.Parallel()
+		sourceDir, targetDir, cleanup := setupTestDirs(t)
+		defer cleanup()
+
+		sourcePath := filepath.Join(sourceDir, "file.txt")
+		targetPath := filepath.Join(targetDir, "file.txt")
+
+		err := os.WriteFile(sourcePath, []byte("linked content"), 0600)
+		if err != nil {
+			t.Fatalf("Failed to create source file: %v", err)
+		}
+		err = os.Link(sourcePath, targetPath)
+		if err != nil {
+			t.Fatalf("Failed to create target hardlink: %v", err)
+		}
+
+		cfg := &config.Config{
+			Source:        []string{sourceDir},
+			Target:        []string{targetDir},
+			HashJobs:      4,
+			BufferSize:    4096,
+			CacheType:     config.CacheTypeMemory,
+			HashAlgorithm: config.HashAlgorithmBLAKE2b,
+		}
+		plan, err := relink.BuildPlan(cfg)
+		if err != nil {
+			t.Fatalf("BuildPlan failed: %v", err)
+		}
+
+		if len(plan.Entries) != 0 {
+			t.Errorf("Expected no files to be planned, got %d", len(plan.Entries))
+		}
+	})
+	t.Run("uses full hashes when partial hashes collide", func(t *testing.T) {
+		t.Parallel()
+		sourceDir, targetDir, cleanup := setupTestDirs(t)
+		defer cleanup()
+
+		files := map[string][2]string{
+			"same.txt":      {"head-same-middle-tail", "head-same-middle-tail"},
+			"different.txt": {"head-some-middle-tail", "head-diff-middle-tail"},
+		}
+		for file, contents := range files {
+			err := os.WriteFile(filepath.Join(sourceDir, file), []byte(contents[0]), 0600)
+			if err != nil {
+				t.Fatalf("Failed to create source file: %v", err)
+			}
+			err = os.WriteFile(filepath.Join(targetDir, file), []byte(contents[1]), 0600)
+			if err != nil {
+				t.Fatalf("Failed to create target file: %v", err)
+			}
+		}
+
+		cfg := &config.Config{
+			Source:          []string{sourceDir},
+			Target:          []string{targetDir},
+			HashJobs:        4,
+			BufferSize:      4096,
+			PartialHashSize: 4,
+			CacheType:       config.CacheTypeMemory,
+			HashAlgorithm:   config.HashAlgorithmBLAKE2b,
+		}
+		err := relink.Run(cfg)
+		if err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+
+		for file, contents := range files {
+			sourceInfo, err := os.Stat(filepath.Join(sourceDir, file))
+			if err != nil {
+				t.Fatalf("Failed to stat source file: %v", err)
+			}
+			targetInfo, err := os.Stat(filepath.Join(targetDir, file))
+			if err != nil {
+				t.Fatalf("Failed to stat target file: %v", err)
+			}
+			if want := contents[0] == contents[1]; os.SameFile(sourceInfo, targetInfo) != want {
+				t.Errorf("Files %s hard linked = %v, want %v", file, !want, want)
+			}
+		}
+	})
+	t.Run("rehashes cached files when the hash algorithm changes", func(t *testing.T) {
+		t.Parallel()
+		sourceDir, targetDir, cleanup := setupTestDirs(t)
+		defer cleanup()
+
+		sourcePath := filepath.Join(sourceDir, "file.txt")
+		targetPath := filepath.Join(targetDir, "file.txt")
+
+		err := os.WriteFile(sourcePath, []byte("cached content"), 0600)
+		if err != nil {
+			t.Fatalf("Failed to create source file: %v", err)
+		}
+		err = os.WriteFile(targetPath, []byte("cached content"), 0600)
+		if err != nil {
+			t.Fatalf("Failed to create target file: %v", err)
+		}
+
+		cfg := &config.Config{
+			Source:        []string{sourceDir},
+			Target:        []string{targetDir},
+			HashJobs:      4,
+			BufferSize:    4096,
+			HashAlgorithm: config.HashAlgorithmBLAKE2b,
+			CacheType:     config.CacheTypeSQLite,
+			CachePath:     filepath.Join(t.TempDir(), "cache.db"),
+			DryRun:        true,
+		}
+		err = relink.Run(cfg)
+		if err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+
+		cfg.HashAlgorithm = config.HashAlgorithmXXH3
+		plan, err := relink.BuildPlan(cfg)
+		if err != nil {
+			t.Fatalf("BuildPlan failed: %v", err)
+		}
+		if len(plan.Entries) != 1 {
+			t.Errorf("Expected 1 file to be planned, got %d", len(plan.Entries))
+		}
+	})
+	t.Run("rehashes cached files when the partial hash size changes", func(t *testing.T) {
+		t.Parallel()
+		sourceDir, targetDir, cleanup := setupTestDirs(t)
+		defer cleanup()
+
+		sourcePath := filepath.Join(sourceDir, "file.txt")
+		targetPath := filepath.Join(targetDir, "file.txt")
+
+		err := os.WriteFile(sourcePath, []byte("head-same-middle-tail"), 0600)
+		if err != nil {
+			t.Fatalf("Failed to create source file: %v", err)
+		}
+		err = os.WriteFile(targetPath, []byte("head-same-middle-tail"), 0600)
+		if err != nil {
+			t.Fatalf("Failed to create target file: %v", err)
+		}
+
+		cfg := &config.Config{
+			Source:          []string{sourceDir},
+			Target:          []string{targetDir},
+			HashJobs:        4,
+			BufferSize:      4096,
+			PartialHashSize: 4,
+			HashAlgorithm:   config.HashAlgorithmBLAKE2b,
+			CacheType:       config.CacheTypeSQLite,
+			CachePath:       filepath.Join(t.TempDir(), "cache.db"),
+			DryRun:          true,
+		}
+		err = relink.Run(cfg)
+		if err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+
+		cfg.PartialHashSize = 8
+		plan, err := relink.BuildPlan(cfg)
+		if err != nil {
+			t.Fatalf("BuildPlan failed: %v", err)
+		}
+		if len(plan.Entries) != 1 {
+			t.Errorf("Expected 1 file to be planned, got %d", len(plan.Entries))
+		}
+	})
+	t.Run("rehashes cached files that changed", func(t *testing.T) {
+		t.Parallel()
+		sourceDir, targetDir, cleanup := setupTestDirs(t)
+		defer cleanup()
+
+		sourcePath := filepath.Join(sourceDir, "file.txt")
+		targetPath := filepath.Join(targetDir, "file.txt")
+
+		err := os.WriteFile(sourcePath, []byte("old content"), 0600)
+		if err != nil {
+			t.Fatalf("Failed to create source file: %v", err)
+		}
+		err = os.WriteFile(targetPath, []byte("new content"), 0600)
+		if err != nil {
+			t.Fatalf("Failed to create target file: %v", err)
+		}
+
+		cfg := &config.Config{
+			Source:        []string{sourceDir},
+			Target:        []string{targetDir},
+			HashJobs:      4,
+			BufferSize:    4096,
+			HashAlgorithm: config.HashAlgorithmBLAKE2b,
+			CacheType:     config.CacheTypeSQLite,
+			CachePath:     filepath.Join(t.TempDir(), "cache.db"),
+		}
+		plan, err := relink.BuildPlan(cfg)
+		if err != nil {
+			t.Fatalf("BuildPlan failed: %v", err)
+		}
+		if len(plan.Entries) != 0 {
+			t.Fatalf("Expected no files to be planned, got %d", len(plan.Entries))
+		}
+
+		// Same size, different content and modification time
+		err = os.WriteFile(sourcePath, []byte("new content"), 0600)
+		if err != nil {
+			t.Fatalf("Failed to update source file: %v", err)
+		}
+		modTime := time.Now().Add(time.Hour)
+		err = os.Chtimes(sourcePath, modTime, modTime)
+		if err != nil {
+			t.Fatalf("Failed to set source file times: %v", err)
+		}
+
+		plan, err = relink.BuildPlan(cfg)
+		if err != nil {
+			t.Fatalf("BuildPlan failed: %v", err)
+		}
+		if len(plan.Entries) != 1 {
+			t.Errorf("Expected 1 file to be planned, got %d", len(plan.Entries))
+		}
+	})
+	t.Run("plans from a reused bolt cache", func(t *testing.T) {
+		t.Parallel()
+		sourceDir, targetDir, cleanup := setupTestDirs(t)
+		defer cleanup()
+
+		for _, name := range []string{"a.txt", "b.txt"} {
+			content := []byte("bolt content " + name)
+			err := os.WriteFile(filepath.Join(sourceDir, name), content, 0600)
+			if err != nil {
+				t.Fatalf("Failed to create source file: %v", err)
+			}
+			err = os.WriteFile(filepath.Join(targetDir, name), content, 0600)
+			if err != nil {
+				t.Fatalf("Failed to create target file: %v", err)
+			}
+		}
+
+		cfg := &config.Config{
+			Source:        []string{sourceDir},
+			Target:        []string{targetDir},
+			HashJobs:      4,
+			BufferSize:    4096,
+			HashAlgorithm: config.HashAlgorithmBLAKE2b,
+			CacheType:     config.CacheTypeBolt,
+			CachePath:     filepath.Join(t.TempDir(), "cache.bolt"),
+		}
+		for range 2 {
+			plan, err := relink.BuildPlan(cfg)
+			if err != nil {
+				t.Fatalf("BuildPlan failed: %v", err)
+			}
+			if len(plan.Entries) != 2 {
+				t.Errorf("Expected 2 files to be planned, got %d", len(plan.Entries))
+			}
+		}
+	})
+	t.Run("never hashes files with a size unique to their tree", func(t *testing.T) {
+		t.Parallel()
+		sourceDir, targetDir, cleanup := setupTestDirs(t)
+		defer cleanup()
+
+		files := map[string]string{
+			filepath.Join(sourceDir, "shared.txt"):      "shared content",
+			filepath.Join(targetDir, "shared.txt"):      "shared content",
+			filepath.Join(sourceDir, "source-only.txt"): "a source file with a unique size",
+			filepath.Join(targetDir, "target-only.txt"): "a target file with an even more unique size",
+		}
+		for path, content := range files {
+			err := os.WriteFile(path, []byte(content), 0600)
+			if err != nil {
+				t.Fatalf("Failed to create file: %v", err)
+			}
+		}
+		// Hashing either unique file would fail, except for root, which can
+		// read them anyway, so the cache is checked for the source as well
+		for _, path := range []string{filepath.Join(sourceDir, "source-only.txt"), filepath.Join(targetDir, "target-only.txt")} {
+			err := os.Chmod(path, 0)
+			if err != nil {
+				t.Fatalf("Failed to chmod file: %v", err)
+			}
+		}
+
+		cachePath := filepath.Join(t.TempDir(), "cache.bolt")
+		cfg := &config.Config{
+			Source:        []string{sourceDir},
+			Target:        []string{targetDir},
+			HashJobs:      4,
+			BufferSize:    4096,
+			HashAlgorithm: config.HashAlgorithmBLAKE2b,
+			CacheType:     config.CacheTypeBolt,
+			CachePath:     cachePath,
+		}
+		plan, err := relink.BuildPlan(cfg)
+		if err != nil {
+			t.Fatalf("BuildPlan failed: %v", err)
+		}
+		if len(plan.Entries) != 1 || filepath.Base(plan.Entries[0].Target) != "shared.txt" {
+			t.Errorf("Expected only shared.txt to be planned, got %v", plan.Entries)
+		}
+
+		cc, err := relink.OpenCache(config.CacheTypeBolt, cachePath)
+		if err != nil {
+			t.Fatalf("Failed to open cache: %v", err)
+		}
+		defer cc.Close()
+		for name, wantCached := range map[string]bool{"shared.txt": true, "source-only.txt": false} {
+			path, err := filepath.Abs(filepath.Join(sourceDir, name))
+			if err != nil {
+				t.Fatalf("Failed to get absolute path: %v", err)
+			}
+			_, ok, err := cc.Get(path)
+			if err != nil {
+				t.Fatalf("Failed to get cache entry: %v", err)
+			}
+			if ok != wantCached {
+				t.Errorf("Expected %s cached = %v, got %v", name, wantCached, ok)
+			}
+		}
+	})
+	t.Run("prefers the highest priority source", func(t *testing.T) {
+		t.Parallel()
+		primaryDir, targetDir, cleanup := setupTestDirs(t)
+		defer cleanup()
+		secondaryDir := t.TempDir()
+
+		for _, dir := range []string{primaryDir, secondaryDir, targetDir} {
+			err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("shared content"), 0600)
+			if err != nil {
+				t.Fatalf("Failed to create file: %v", err)
+			}
+		}
+		err := os.WriteFile(filepath.Join(secondaryDir, "only.txt"), []byte("secondary content"), 0600)
+		if err != nil {
+			t.Fatalf("Failed to create secondary file: %v", err)
+		}
+		err = os.WriteFile(filepath.Join(targetDir, "only.txt"), []byte("secondary content"), 0600)
+		if err != nil {
+			t.Fatalf("Failed to create target file: %v", err)
+		}
+
+		for _, sources := range [][]string{{secondaryDir, primaryDir}, {primaryDir, secondaryDir}} {
+			cfg := &config.Config{
+				Source:        sources,
+				Target:        []string{targetDir},
+				HashJobs:      4,
+				BufferSize:    4096,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+			}
+			plan, err := relink.BuildPlan(cfg)
+			if err != nil {
+				t.Fatalf("BuildPlan failed: %v", err)
+			}
+			if len(plan.Entries) != 2 {
+				t.Fatalf("Expected 2 files to be planned, got %d", len(plan.Entries))
+			}
+			for _, entry := range plan.Entries {
+				dir := plan.Sources[0]
+				if filepath.Base(entry.Target) == "only.txt" {
+					dir = secondaryDir
+				}
+				want, err := filepath.Abs(filepath.Join(dir, filepath.Base(entry.Target)))
+				if err != nil {
+					t.Fatalf("Failed to get absolute path: %v", err)
+				}
+				if entry.Source != want {
+					t.Errorf("Expected %s to link to %s, got %s", entry.Target, want, entry.Source)
+				}
+			}
+		}
+	})
+	t.Run("links every target against the same sources", func(t *testing.T) {
+		t.Parallel()
+		sourceDir, targetDir, cleanup := setupTestDirs(t)
+		defer cleanup()
+		otherTargetDir := t.TempDir()
+
+		for _, dir := range []string{sourceDir, targetDir, otherTargetDir} {
+			err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("shared content"), 0600)
+			if err != nil {
+				t.Fatalf("Failed to create file: %v", err)
+			}
+		}
+
+		cfg := &config.Config{
+			Source:        []string{sourceDir},
+			Target:        []string{targetDir, otherTargetDir},
+			HashJobs:      4,
+			BufferSize:    4096,
+			HashAlgorithm: config.HashAlgorithmBLAKE2b,
+			CacheType:     config.CacheTypeMemory,
+		}
+		err := relink.Run(cfg)
+		if err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+
+		sourceInfo, err := os.Stat(filepath.Join(sourceDir, "file.txt"))
+		if err != nil {
+			t.Fatalf("Failed to stat source file: %v", err)
+		}
+		for _, dir := range cfg.Target {
+			targetInfo, err := os.Stat(filepath.Join(dir, "file.txt"))
+			if err != nil {
+				t.Fatalf("Failed to stat target file: %v", err)
+			}
+			if !os.SameFile(sourceInfo, targetInfo) {
+				t.Errorf("Expected %s to be hardlinked to the source", dir)
+			}
+		}
+	})
+	t.Run("deduplicates within the sources in self mode", func(t *testing.T) {
+		t.Parallel()
+		sourceDir, _, cleanup := setupTestDirs(t)
+		defer cleanup()
+
+		files := []string{"a.txt", "nested/b.txt", "nested/deeper/c.txt"}
+		for i, file := range files {
+			path := filepath.Join(sourceDir, file)
+			err := os.MkdirAll(filepath.Dir(path), 0755)
+			if err != nil {
+				t.Fatalf("Failed to create directory: %v", err)
+			}
+			err = os.WriteFile(path, []byte("duplicate content"), 0600)
+			if err != nil {
+				t.Fatalf("Failed to create file: %v", err)
+			}
+			// The deepest file is the oldest
+			modTime := time.Now().Add(-time.Duration(i+1) * time.Hour)
+			err = os.Chtimes(path, modTime, modTime)
+			if err != nil {
+				t.Fatalf("Failed to set file times: %v", err)
+			}
+		}
+		err := os.WriteFile(filepath.Join(sourceDir, "unique.txt"), []byte("unique content!!!"), 0600)
+		if err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+
+		for canonical, want := range map[config.Canonical]string{
+			config.CanonicalOldest:       "nested/deeper/c.txt",
+			config.CanonicalShortestPath: "a.txt",
+		} {
+			cfg := &config.Config{
+				Mode:          config.ModeSelf,
+				Canonical:     canonical,
+				Source:        []string{sourceDir},
+				HashJobs:      4,
+				BufferSize:    4096,
+				HashAlgorithm: config.HashAlgorithmBLAKE2b,
+				CacheType:     config.CacheTypeMemory,
+			}
+			plan, err := relink.BuildPlan(cfg)
+			if err != nil {
+				t.Fatalf("BuildPlan failed: %v", err)
+			}
+			if len(plan.Entries) != 2 {
+				t.Fatalf("Expected 2 files to be planned, got %d", len(plan.Entries))
+			}
+			wantSource, err := filepath.Abs(filepath.Join(sourceDir, want))
+			if err != nil {
+				t.Fatalf("Failed to get absolute path: %v", err)
+			}
+			for _, entry := range plan.Entries {
+				if entry.Source != wantSource {
+					t.Errorf("Expected %s canonical file %s, got %s", canonical, wantSource, entry.Source)
+				}
+			}
+		}
+
+		cfg := &config.Config{
+			Mode:          config.ModeSelf,
+			Canonical:     config.CanonicalOldest,
+			Source:        []string{sourceDir},
+			HashJobs:      4,
+			BufferSize:    4096,
+			HashAlgorithm: config.HashAlgorithmBLAKE2b,
+			CacheType:     config.CacheTypeMemory,
+		}
+		err = relink.Run(cfg)
+		if err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+		canonicalInfo, err := os.Stat(filepath.Join(sourceDir, "nested/deeper/c.txt"))
+		if err != nil {
+			t.Fatalf("Failed to stat canonical file: %v", err)
+		}
+		for _, file := range files {
+			info, err := os.Stat(filepath.Join(sourceDir, file))
+			if err != nil {
+				t.Fatalf("Failed to stat file: %v", err)
+			}
+			if !os.SameFile(canonicalInfo, info) {
+				t.Errorf("Expected %s to be hardlinked to the canonical file", file)
+			}
+		}
+
+		plan, err := relink.BuildPlan(cfg)
+		if err != nil {
+			t.Fatalf("BuildPlan failed: %v", err)
+		}
+		if len(plan.Entries) != 0 {
+			t.Errorf("Expected no files to be planned after linking, got %d", len(plan.Entries))
+		}
+	})
+
+	t.Run("applies the cross-device policy", func(t *testing.T) {
+		t.Parallel()
+		sourceDir, _, cleanup := setupTestDirs(t)
+		defer cleanup()
+
+		// /dev/shm is usually a tmpfs, separate from the working directory
+		targetDir, err := os.MkdirTemp("/dev/shm", "relink-target-*")
+		if err != nil {
+			t.Skipf("Failed to create target dir on another device: %v", err)
+		}
+		defer os.RemoveAll(targetDir)
+		sourceDirInfo, err := os.Stat(sourceDir)
+		if err != nil {
+			t.Fatalf("Failed to stat source dir: %v", err)
+		}
+		targetDirInfo, err := os.Stat(targetDir)
+		if err != nil {
+			t.Fatalf("Failed to stat target dir: %v", err)
+		}
+		if sourceDirInfo.Sys().(*syscall.Stat_t).Dev == targetDirInfo.Sys().(*syscall.Stat_t).Dev {
+			t.Skip("Source and target dirs are on the same device")
+		}
+
+		sourcePath := filepath.Join(sourceDir, "file.txt")
+		targetPath := filepath.Join(targetDir, "file.txt")
+		if err := os.WriteFile(sourcePath, []byte("cross-device"), 0600); err != nil {
+			t.Fatalf("Failed to create source file: %v", err)
+		}
+		if err := os.WriteFile(targetPath, []byte("cross-device"), 0600); err != nil {
+			t.Fatalf("Failed to create target file: %v", err)
+		}
+
+		cfg := &config.Config{
+			Source:        []string{sourceDir},
+			Target:        []string{targetDir},
+			HashJobs:      4,
+			BufferSize:    4096,
+			HashAlgorithm: config.HashAlgorithmBLAKE2b,
+			CacheType:     config.CacheTypeMemory,
+			LinkMode:      config.LinkModeHardlink,
+			CrossDevice:   config.CrossDeviceSkip,
+		}
+		plan, err := relink.BuildPlan(cfg)
+		if err != nil {
+			t.Fatalf("BuildPlan failed: %v", err)
+		}
+		if len(plan.Entries) != 0 {
+			t.Errorf("Expected cross-device file to be skipped, got %d entries", len(plan.Entries))
+		}
+
+		cfg.CrossDevice = config.CrossDeviceReflink
+		err = relink.Run(cfg)
+		if err != nil {
+			t.Fatalf("Run with reflink policy failed: %v", err)
+		}
+		info, err := os.Lstat(targetPath)
+		if err != nil {
+			t.Fatalf("Failed to stat target file: %v", err)
+		}
+		if !info.Mode().IsRegular() {
+			t.Error("Expected target to be left alone when it can't be reflinked")
+		}
+
+		cfg.CrossDevice = config.CrossDeviceSymlink
+		err = relink.Run(cfg)
+		if err != nil {
+			t.Fatalf("Run with symlink policy failed: %v", err)
+		}
+		info, err = os.Lstat(targetPath)
+		if err != nil {
+			t.Fatalf("Failed to stat target file: %v", err)
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			t.Error("Expected cross-device target to be replaced with a symlink")
+		}
+	})
+	t.Run("applies the cross-device policy across mount points", func(t *testing.T) {
+		t.Parallel()
+		sourceDir, targetDir, cleanup := setupTestDirs(t)
+		defer cleanup()
+
+		// A bind mount of the target dir is on the same device as the source
+		// dir, yet hardlinks into it fail with EXDEV
+		mountPoint, err := os.MkdirTemp(".", "relink-mount-*")
+		if err != nil {
+			t.Fatalf("Failed to create mount point: %v", err)
+		}
+		defer os.RemoveAll(mountPoint)
+		if out, err := exec.Command("mount", "--bind", targetDir, mountPoint).CombinedOutput(); err != nil {
+			t.Skipf("Failed to bind mount target dir: %v: %s", err, out)
+		}
+		defer func() {
+			if out, err := exec.Command("umount", mountPoint).CombinedOutput(); err != nil {
+				t.Errorf("Failed to unmount target dir: %v: %s", err, out)
+			}
+		}()
+
+		sourcePath := filepath.Join(sourceDir, "file.txt")
+		targetPath := filepath.Join(mountPoint, "file.txt")
+		if err := os.WriteFile(sourcePath, []byte("cross-mount"), 0600); err != nil {
+			t.Fatalf("Failed to create source file: %v", err)
+		}
+		if err := os.WriteFile(targetPath, []byte("cross-mount"), 0600); err != nil {
+			t.Fatalf("Failed to create target file: %v", err)
+		}
+
+		cfg := &config.Config{
+			Source:        []string{sourceDir},
+			Target:        []string{mountPoint},
+			HashJobs:      4,
+			BufferSize:    4096,
+			HashAlgorithm: config.HashAlgorithmBLAKE2b,
+			CacheType:     config.CacheTypeMemory,
+			LinkMode:      config.LinkModeHardlink,
+			CrossDevice:   config.CrossDeviceSkip,
+		}
+		err = relink.Run(cfg)
+		if err != nil {
+			t.Fatalf("Run with skip policy failed: %v", err)
+		}
+		info, err := os.Lstat(targetPath)
+		if err != nil {
+			t.Fatalf("Failed to stat target file: %v", err)
+		}
+		if !info.Mode().IsRegular() {
+			t.Error("Expected target to be skipped when it can't be hardlinked")
+		}
+
+		cfg.CrossDevice = config.CrossDeviceSymlink
+		err = relink.Run(cfg)
+		if err != nil {
+			t.Fatalf("Run with symlink policy failed: %v", err)
+		}
+		info, err = os.Lstat(targetPath)
+		if err != nil {
+			t.Fatalf("Failed to stat target file: %v", err)
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			t.Error("Expected target to be replaced with a symlink when it can't be hardlinked")
+		}
+	})
 }
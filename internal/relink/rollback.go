@@ -0,0 +1,138 @@
+package relink
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+func Rollback(journalPath string, bufferSize int) error {
+	entries, err := ReadJournal(journalPath)
+	if err != nil {
+		return err
+	}
+
+	// Walk the journal backwards so a file replaced in several runs ends up
+	// with the metadata it had before the first one.
+	for _, entry := range slices.Backward(entries) {
+		info, err := os.Lstat(entry.Target)
+		if errors.Is(err, os.ErrNotExist) {
+			slog.Warn("skipping file that no longer exists", "target", entry.Target)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to stat target file: %w", err)
+		}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			// Symlinks are restored from the source they point at
+			if !pointsAt(entry.Target, entry.Source) {
+				slog.Warn("skipping symlink that no longer points at the source", "target", entry.Target, "source", entry.Source)
+				continue
+			}
+		case !info.Mode().IsRegular():
+			slog.Warn("skipping file that is no longer a regular file", "target", entry.Target)
+			continue
+		case inode(info) == entry.Inode:
+			slog.Debug("file was never replaced, skipping", "target", entry.Target)
+			continue
+		}
+		// Anything that replaced the link since would be given metadata it
+		// never had
+		if info.Mode().IsRegular() {
+			linked, err := linkedTo(entry.Target, info, entry.Source)
+			if err != nil {
+				return err
+			}
+			if !linked {
+				slog.Warn("skipping file that is no longer linked to the source", "target", entry.Target, "source", entry.Source)
+				continue
+			}
+		}
+
+		err = restore(entry, bufferSize)
+		if err != nil {
+			return err
+		}
+		slog.Info("link broken, original metadata restored", "target", entry.Target)
+	}
+
+	return nil
+}
+
+func restore(entry JournalEntry, bufferSize int) error {
+	tempName, err := GetSafeTempFile(filepath.Dir(entry.Target), ".relink-"+filepath.Base(entry.Target))
+	if err != nil {
+		return fmt.Errorf("failed to create temp file for %s: %w", entry.Target, err)
+	}
+	defer os.Remove(tempName)
+
+	err = copyFile(entry.Target, tempName, bufferSize)
+	if err != nil {
+		return fmt.Errorf("failed to copy %s: %w", entry.Target, err)
+	}
+
+	hash, err := HashFile(tempName, entry.HashAlgorithm, bufferSize, nil)
+	if err != nil {
+		return fmt.Errorf("failed to hash %s: %w", tempName, err)
+	}
+	if hex.EncodeToString(hash) != entry.Hash {
+		slog.Warn("file content changed since it was replaced, keeping the current content", "target", entry.Target)
+	}
+
+	err = setMetadata(tempName, entry.UID, entry.GID, entry.Mode, entry.AccessTime, entry.ModTime)
+	if errors.Is(err, errOwnerNotSet) {
+		slog.Warn("failed to restore file owner", "target", entry.Target, "uid", entry.UID, "gid", entry.GID, "error", err)
+	} else if err != nil {
+		return fmt.Errorf("failed to restore metadata of %s: %w", entry.Target, err)
+	}
+
+	if err := os.Rename(tempName, entry.Target); err != nil {
+		return fmt.Errorf("failed to move copy from %s to %s: %w", tempName, entry.Target, err)
+	}
+	return nil
+}
+
+// linkedTo reports whether the regular file at path is still a hardlink to, or
+// a reflink sharing every extent with, source.
+func linkedTo(path string, info fs.FileInfo, source string) (bool, error) {
+	sourceInfo, err := os.Stat(source)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to stat source file: %w", err)
+	}
+	if os.SameFile(info, sourceInfo) {
+		return true, nil
+	}
+	return SharesExtents(source, path)
+}
+
+func copyFile(source, target string, bufferSize int) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.CopyBuffer(out, in, make([]byte, bufferSize)); err != nil {
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,215 @@
+package relink_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/relink/internal/config"
+	"github.com/USA-RedDragon/relink/internal/relink"
+)
+
+func TestRollback(t *testing.T) {
+	t.Parallel()
+	sourceDir, targetDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	sourcePath := filepath.Join(sourceDir, "file.txt")
+	targetPath := filepath.Join(targetDir, "file.txt")
+	if err := os.WriteFile(sourcePath, []byte("content"), 0600); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetPath, []byte("content"), 0640); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+	if err := os.Chmod(targetPath, 0640); err != nil {
+		t.Fatalf("Failed to chmod target file: %v", err)
+	}
+	modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(targetPath, modTime, modTime); err != nil {
+		t.Fatalf("Failed to set target file times: %v", err)
+	}
+
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+	cfg := &config.Config{
+		Source:        []string{sourceDir},
+		Target:        []string{targetDir},
+		HashJobs:      4,
+		BufferSize:    4096,
+		CacheType:     config.CacheTypeMemory,
+		HashAlgorithm: config.HashAlgorithmBLAKE2b,
+		Journal:       journalPath,
+	}
+	if err := relink.Run(cfg); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	entries, err := relink.ReadJournal(journalPath)
+	if err != nil {
+		t.Fatalf("ReadJournal() failed: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("ReadJournal() returned %d entries, want %d", len(entries), 1)
+	}
+
+	if err := relink.Rollback(journalPath, 4096); err != nil {
+		t.Fatalf("Rollback() failed: %v", err)
+	}
+
+	sourceInfo, err := os.Stat(sourcePath)
+	if err != nil {
+		t.Fatalf("Failed to stat source file: %v", err)
+	}
+	targetInfo, err := os.Stat(targetPath)
+	if err != nil {
+		t.Fatalf("Failed to stat target file: %v", err)
+	}
+	if os.SameFile(sourceInfo, targetInfo) {
+		t.Error("Files should no longer be hard linked after rollback")
+	}
+	if targetInfo.Mode().Perm() != 0640 {
+		t.Errorf("Target mode = %v, want %v", targetInfo.Mode().Perm(), os.FileMode(0640))
+	}
+	if !targetInfo.ModTime().Equal(modTime) {
+		t.Errorf("Target mtime = %v, want %v", targetInfo.ModTime(), modTime)
+	}
+	content, err := os.ReadFile(targetPath)
+	if err != nil {
+		t.Fatalf("Failed to read target file: %v", err)
+	}
+	if string(content) != "content" {
+		t.Errorf("Target content = %q, want %q", content, "content")
+	}
+}
+
+func TestRollbackSymlink(t *testing.T) {
+	t.Parallel()
+	sourceDir, targetDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	sourcePath := filepath.Join(sourceDir, "file.txt")
+	targetPath := filepath.Join(targetDir, "file.txt")
+	if err := os.WriteFile(sourcePath, []byte("content"), 0600); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetPath, []byte("content"), 0640); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+	cfg := &config.Config{
+		Source:        []string{sourceDir},
+		Target:        []string{targetDir},
+		HashJobs:      4,
+		BufferSize:    4096,
+		CacheType:     config.CacheTypeMemory,
+		HashAlgorithm: config.HashAlgorithmBLAKE2b,
+		LinkMode:      config.LinkModeSymlink,
+		SymlinkStyle:  config.SymlinkStyleRelative,
+		Journal:       journalPath,
+	}
+	if err := relink.Run(cfg); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	info, err := os.Lstat(targetPath)
+	if err != nil {
+		t.Fatalf("Failed to stat target file: %v", err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Fatal("Target should be a symlink after running")
+	}
+
+	if err := relink.Rollback(journalPath, 4096); err != nil {
+		t.Fatalf("Rollback() failed: %v", err)
+	}
+
+	info, err = os.Lstat(targetPath)
+	if err != nil {
+		t.Fatalf("Failed to stat target file: %v", err)
+	}
+	if !info.Mode().IsRegular() {
+		t.Error("Target should be a regular file after rollback")
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("Target mode = %v, want %v", info.Mode().Perm(), os.FileMode(0640))
+	}
+	content, err := os.ReadFile(targetPath)
+	if err != nil {
+		t.Fatalf("Failed to read target file: %v", err)
+	}
+	if string(content) != "content" {
+		t.Errorf("Target content = %q, want %q", content, "content")
+	}
+}
+
+func TestRollbackSkipsRewrittenTargets(t *testing.T) {
+	t.Parallel()
+	sourceDir, targetDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	sourcePath := filepath.Join(sourceDir, "file.txt")
+	targetPath := filepath.Join(targetDir, "file.txt")
+	if err := os.WriteFile(sourcePath, []byte("content"), 0600); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetPath, []byte("content"), 0600); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+	modTime := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(targetPath, modTime, modTime); err != nil {
+		t.Fatalf("Failed to set target file times: %v", err)
+	}
+	// Keep the original target's inode alive, so the rewritten target can't
+	// reuse its number and pass for a file that was never replaced
+	keepDir, err := os.MkdirTemp(".", "relink-keep-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(keepDir)
+	if err := os.Link(targetPath, filepath.Join(keepDir, "file.txt")); err != nil {
+		t.Fatalf("Failed to link target file: %v", err)
+	}
+
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+	cfg := &config.Config{
+		Source:        []string{sourceDir},
+		Target:        []string{targetDir},
+		HashJobs:      4,
+		BufferSize:    4096,
+		CacheType:     config.CacheTypeMemory,
+		HashAlgorithm: config.HashAlgorithmBLAKE2b,
+		Journal:       journalPath,
+	}
+	if err := relink.Run(cfg); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	// Another tool replaces the link with new data after the run
+	if err := os.Remove(targetPath); err != nil {
+		t.Fatalf("Failed to remove target file: %v", err)
+	}
+	if err := os.WriteFile(targetPath, []byte("new content"), 0644); err != nil {
+		t.Fatalf("Failed to rewrite target file: %v", err)
+	}
+	before, err := os.Stat(targetPath)
+	if err != nil {
+		t.Fatalf("Failed to stat target file: %v", err)
+	}
+
+	if err := relink.Rollback(journalPath, 4096); err != nil {
+		t.Fatalf("Rollback() failed: %v", err)
+	}
+
+	after, err := os.Stat(targetPath)
+	if err != nil {
+		t.Fatalf("Failed to stat target file: %v", err)
+	}
+	if !os.SameFile(before, after) {
+		t.Error("Rollback should leave a rewritten target alone")
+	}
+	if after.Mode().Perm() != 0644 || !after.ModTime().Equal(before.ModTime()) {
+		t.Errorf("Rollback changed the rewritten target's metadata to %v %v", after.Mode().Perm(), after.ModTime())
+	}
+}
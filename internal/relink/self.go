@@ -0,0 +1,135 @@
+package relink
+
+import (
+	"cmp"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/USA-RedDragon/relink/internal/config"
+	"github.com/USA-RedDragon/relink/internal/relink/cache"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
+)
+
+// buildSelfPlan plans hardlinks between duplicates within the sources. Each
+// group of identical files is linked to one canonical file.
+func buildSelfPlan(cfg *config.Config, cc cache.Cache, absSources []string, files []FileInfo) (*Plan, error) {
+	walked := len(files)
+	files = filterByDuplicateSize(files)
+	slog.Info("Filtered files by size", "source", len(files), "sourceSkipped", walked-len(files))
+
+	err := hashSources(cfg, cc, files)
+	if err != nil {
+		return nil, err
+	}
+
+	partials := map[string][]FileInfo{}
+	for _, file := range files {
+		entry, _, err := cc.Get(file.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get file from cache: %w", err)
+		}
+		partials[string(entry.Partial)] = append(partials[string(entry.Partial)], file)
+	}
+
+	// Only files whose partial hashes collide need their full hash
+	slog.Info("Hashing duplicate candidates")
+	grp := errgroup.Group{}
+	grp.SetLimit(cfg.HashJobs)
+	var fullHashes singleflight.Group
+	for _, group := range partials {
+		if len(group) < 2 {
+			continue
+		}
+		for _, file := range group {
+			grp.Go(func() error {
+				return ensureFullHash(cc, &fullHashes, file.Path, cfg)
+			})
+		}
+	}
+	err = grp.Wait()
+	if err != nil {
+		slog.Error("failed to process files", "error", err)
+		return nil, err
+	}
+
+	plan := NewPlan(absSources, []string{}, cfg.HashAlgorithm)
+	plan.Mode = config.ModeSelf
+	plan.LinkMode = cfg.LinkMode
+	plan.SymlinkStyle = cfg.SymlinkStyle
+	for _, group := range partials {
+		if len(group) < 2 {
+			continue
+		}
+		hashes := map[string][]FileInfo{}
+		for _, file := range group {
+			entry, _, err := cc.Get(file.Path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get file from cache: %w", err)
+			}
+			hashes[string(entry.Hash)] = append(hashes[string(entry.Hash)], file)
+		}
+
+		for hash, duplicates := range hashes {
+			if len(duplicates) < 2 {
+				continue
+			}
+			canonical := electCanonical(duplicates, cfg.Canonical)
+			for _, file := range duplicates {
+				if os.SameFile(canonical.Info, file.Info) {
+					slog.Debug("file is already hardlinked to canonical file", "source", canonical.Path, "target", file.Path)
+					continue
+				}
+				linkMode, ok := crossDeviceLinkMode(cfg, canonical.Path, file.Path, canonical.Info, file.Info)
+				if !ok {
+					continue
+				}
+				shared, err := alreadyShared(cfg, linkMode, canonical.Path, file.Path)
+				if err != nil {
+					return nil, err
+				}
+				if shared {
+					slog.Debug("file already shares its extents with canonical file", "source", canonical.Path, "target", file.Path)
+					continue
+				}
+				plan.Add(PlanEntry{
+					Target:        file.Path,
+					Source:        canonical.Path,
+					Hash:          hex.EncodeToString([]byte(hash)),
+					Size:          uint64(file.Info.Size()),
+					ModTime:       file.Info.ModTime(),
+					Inode:         inode(file.Info),
+					SourceModTime: canonical.Info.ModTime(),
+					SourceInode:   inode(canonical.Info),
+					LinkMode:      linkMode,
+				})
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+// electCanonical picks the file every other duplicate is linked to, breaking
+// ties by path so repeated runs pick the same file.
+func electCanonical(duplicates []FileInfo, canonical config.Canonical) FileInfo {
+	return slices.MinFunc(duplicates, func(a, b FileInfo) int {
+		var c int
+		switch canonical {
+		case config.CanonicalOldest:
+			c = a.Info.ModTime().Compare(b.Info.ModTime())
+		case config.CanonicalShortestPath:
+			c = len(a.Path) - len(b.Path)
+		case config.CanonicalLowestInode:
+			c = cmp.Compare(inode(a.Info), inode(b.Info))
+		}
+		if c != 0 {
+			return c
+		}
+		return strings.Compare(a.Path, b.Path)
+	})
+}
@@ -0,0 +1,35 @@
+package relink
+
+func sizeIndex(files []FileInfo) map[int64]struct{} {
+	sizes := make(map[int64]struct{}, len(files))
+	for _, file := range files {
+		sizes[file.Info.Size()] = struct{}{}
+	}
+	return sizes
+}
+
+func filterBySize(files []FileInfo, sizes map[int64]struct{}) []FileInfo {
+	filtered := make([]FileInfo, 0, len(files))
+	for _, file := range files {
+		if _, ok := sizes[file.Info.Size()]; ok {
+			filtered = append(filtered, file)
+		}
+	}
+	return filtered
+}
+
+// filterByDuplicateSize keeps the files whose size is shared by at least one
+// other file.
+func filterByDuplicateSize(files []FileInfo) []FileInfo {
+	counts := make(map[int64]int, len(files))
+	for _, file := range files {
+		counts[file.Info.Size()]++
+	}
+	filtered := make([]FileInfo, 0, len(files))
+	for _, file := range files {
+		if counts[file.Info.Size()] > 1 {
+			filtered = append(filtered, file)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,61 @@
+package relink
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+
+	"github.com/USA-RedDragon/relink/internal/relink/cache"
+)
+
+//nolint:unconvert // the syscall.Stat_t field types vary between platforms
+func inode(info fs.FileInfo) uint64 {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
+	return uint64(stat.Ino)
+}
+
+func owner(info fs.FileInfo) (uint32, uint32) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+	return stat.Uid, stat.Gid
+}
+
+func accessTime(info fs.FileInfo) time.Time {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime()
+	}
+	return time.Unix(stat.Atim.Unix())
+}
+
+func changeTime(info fs.FileInfo) time.Time {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime()
+	}
+	return time.Unix(stat.Ctim.Unix())
+}
+
+//nolint:unconvert // the syscall.Stat_t field types vary between platforms
+func device(info fs.FileInfo) uint64 {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
+	return uint64(stat.Dev)
+}
+
+func metadata(info fs.FileInfo) cache.Metadata {
+	return cache.Metadata{
+		Size:       info.Size(),
+		ModTime:    info.ModTime(),
+		ChangeTime: changeTime(info),
+		Inode:      inode(info),
+		Device:     device(info),
+	}
+}
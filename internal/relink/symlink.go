@@ -0,0 +1,47 @@
+package relink
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// AtomicSymlink replaces target with a symlink to source. A relative symlink
+// is resolved from the directory of target, so it keeps working when a tree
+// holding both files is moved or mounted elsewhere.
+func AtomicSymlink(source, target string, relative bool) error {
+	dest := source
+	if relative {
+		var err error
+		dest, err = filepath.Rel(filepath.Dir(target), source)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path from %s to %s: %w", target, source, err)
+		}
+	}
+
+	tempName, err := GetSafeTempFile(filepath.Dir(target), ".relink-"+filepath.Base(target))
+	if err != nil {
+		return fmt.Errorf("failed to create temp file for %s: %w", target, err)
+	}
+	defer os.Remove(tempName)
+	if err = os.Symlink(dest, tempName); err != nil {
+		return fmt.Errorf("failed to create symlink from %s to %s: %w", tempName, dest, err)
+	}
+	if err = os.Rename(tempName, target); err != nil {
+		return fmt.Errorf("failed to move symlink from %s to %s: %w", tempName, target, err)
+	}
+	return nil
+}
+
+// pointsAt reports whether the symlink at path resolves to source.
+func pointsAt(path, source string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	sourceInfo, err := os.Stat(source)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(info, sourceInfo)
+}
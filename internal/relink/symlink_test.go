@@ -0,0 +1,62 @@
+package relink_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/USA-RedDragon/relink/internal/relink"
+)
+
+func TestAtomicSymlink(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		relative bool
+	}{
+		{"relative", true},
+		{"absolute", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tempDir, sourcePath, _ := setupTestFiles(t)
+			defer cleanupTestFiles(t, tempDir)
+
+			targetDir := filepath.Join(tempDir, "nested")
+			if err := os.Mkdir(targetDir, 0700); err != nil {
+				t.Fatalf("Failed to create target directory: %v", err)
+			}
+			targetPath := filepath.Join(targetDir, "target.txt")
+			if err := os.WriteFile(targetPath, []byte("test content"), 0600); err != nil {
+				t.Fatalf("Failed to create target file: %v", err)
+			}
+
+			if err := relink.AtomicSymlink(sourcePath, targetPath, tt.relative); err != nil {
+				t.Fatalf("AtomicSymlink failed: %v", err)
+			}
+
+			dest, err := os.Readlink(targetPath)
+			if err != nil {
+				t.Fatalf("Failed to read symlink: %v", err)
+			}
+			want := sourcePath
+			if tt.relative {
+				want = filepath.Join("..", "source.txt")
+			}
+			if dest != want {
+				t.Errorf("Symlink points at %q, want %q", dest, want)
+			}
+
+			content, err := os.ReadFile(targetPath)
+			if err != nil {
+				t.Fatalf("Failed to read through symlink: %v", err)
+			}
+			if string(content) != "test content" {
+				t.Errorf("Target content = %q, want %q", content, "test content")
+			}
+		})
+	}
+}
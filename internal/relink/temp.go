@@ -7,6 +7,10 @@ func GetSafeTempFile(dir string, prefix string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	err = tempFile.Close()
+	if err != nil {
+		return "", err
+	}
 	err = os.Remove(tempFile.Name())
 	if err != nil {
 		return "", err
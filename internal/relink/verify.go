@@ -0,0 +1,44 @@
+package relink
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+)
+
+func CompareFiles(source, target string, bufferSize int) (bool, error) {
+	sourceFile, err := os.Open(source)
+	if err != nil {
+		return false, err
+	}
+	defer sourceFile.Close()
+
+	targetFile, err := os.Open(target)
+	if err != nil {
+		return false, err
+	}
+	defer targetFile.Close()
+
+	sourceBuf := make([]byte, bufferSize)
+	targetBuf := make([]byte, bufferSize)
+	for {
+		sourceN, sourceErr := io.ReadFull(sourceFile, sourceBuf)
+		if sourceErr != nil && !errors.Is(sourceErr, io.EOF) && !errors.Is(sourceErr, io.ErrUnexpectedEOF) {
+			return false, sourceErr
+		}
+		targetN, targetErr := io.ReadFull(targetFile, targetBuf)
+		if targetErr != nil && !errors.Is(targetErr, io.EOF) && !errors.Is(targetErr, io.ErrUnexpectedEOF) {
+			return false, targetErr
+		}
+
+		if !bytes.Equal(sourceBuf[:sourceN], targetBuf[:targetN]) {
+			return false, nil
+		}
+		// A short read means the end of the file, and since the reads
+		// matched, both files ended at the same place.
+		if sourceErr != nil {
+			return true, nil
+		}
+	}
+}
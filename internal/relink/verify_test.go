@@ -0,0 +1,66 @@
+package relink_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/USA-RedDragon/relink/internal/relink"
+)
+
+func TestCompareFiles(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		source string
+		target string
+		want   bool
+	}{
+		{"identical", "same content", "same content", true},
+		{"empty", "", "", true},
+		{"different content", "some content", "diff content", false},
+		{"target shorter", "content", "cont", false},
+		{"target longer", "cont", "content", false},
+		{"differ after first buffer", "0123456789abcdef-a", "0123456789abcdef-b", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tmpDir := t.TempDir()
+
+			sourcePath := filepath.Join(tmpDir, "source.txt")
+			if err := os.WriteFile(sourcePath, []byte(tt.source), 0600); err != nil {
+				t.Fatalf("Failed to write source file: %v", err)
+			}
+			targetPath := filepath.Join(tmpDir, "target.txt")
+			if err := os.WriteFile(targetPath, []byte(tt.target), 0600); err != nil {
+				t.Fatalf("Failed to write target file: %v", err)
+			}
+
+			got, err := relink.CompareFiles(sourcePath, targetPath, 4)
+			if err != nil {
+				t.Fatalf("CompareFiles() failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("CompareFiles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareFilesNotExist(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+
+	sourcePath := filepath.Join(tmpDir, "source.txt")
+	if err := os.WriteFile(sourcePath, []byte("content"), 0600); err != nil {
+		t.Fatalf("Failed to write source file: %v", err)
+	}
+
+	_, err := relink.CompareFiles(sourcePath, filepath.Join(tmpDir, "nonexistent.txt"), 4)
+	if !os.IsNotExist(err) {
+		t.Errorf("Expected IsNotExist error, got %v", err)
+	}
+}
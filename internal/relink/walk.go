@@ -1,8 +1,10 @@
 package relink
 
 import (
+	"errors"
 	"io/fs"
 	"iter"
+	"log/slog"
 	"os"
 	"path/filepath"
 )
@@ -12,16 +14,38 @@ type FileInfo struct {
 	Info fs.FileInfo
 }
 
-func Walk(root string) iter.Seq2[FileInfo, error] {
+// Walk yields the regular files under root that the filter and any
+// .relinkignore files allow. Excluded directories are not descended into.
+func Walk(root string, filter *Filter) iter.Seq2[FileInfo, error] {
 	return func(yield func(FileInfo, error) bool) {
 		// Check if root exists before walking
 		if _, err := os.Stat(root); os.IsNotExist(err) {
 			return
 		}
 
+		ignores := &ignoreStack{}
 		err := filepath.Walk(root, func(path string, info fs.FileInfo, err error) error {
+			if info == nil {
+				return err
+			}
+
 			if info.IsDir() {
-				return nil
+				// A directory that couldn't be listed is visited a second
+				// time with the error, and is skipped like any other
+				// unreadable subtree
+				if err != nil {
+					slog.Warn("skipping directory that could not be read", "path", path, "error", err)
+					return nil
+				}
+				if path != root && (filter.Excluded(relativePath(root, path)) || ignores.ignored(path, true)) {
+					return filepath.SkipDir
+				}
+				err = ignores.enter(path)
+				if errors.Is(err, fs.ErrPermission) {
+					slog.Warn("skipping directory that could not be read", "path", path, "error", err)
+					return filepath.SkipDir
+				}
+				return err
 			}
 
 			if info.Mode()&os.ModeSymlink != 0 {
@@ -36,6 +60,16 @@ func Walk(root string) iter.Seq2[FileInfo, error] {
 				return nil
 			}
 
+			// Ignore files are left alone so that one team's rules are
+			// never hardlinked to, and edited along with, another's
+			if info.Name() == IgnoreFile {
+				return nil
+			}
+
+			if !filter.AllowsSize(info.Size()) || !filter.Allows(relativePath(root, path)) || ignores.ignored(path, false) {
+				return nil
+			}
+
 			absPath, err := filepath.Abs(path)
 			if !yield(FileInfo{absPath, info}, err) {
 				return fs.SkipAll
@@ -49,3 +83,24 @@ func Walk(root string) iter.Seq2[FileInfo, error] {
 		}
 	}
 }
+
+// relativePath returns path relative to root with forward slashes, which is
+// what filter patterns are matched against.
+func relativePath(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func collect(root string, filter *Filter) ([]FileInfo, error) {
+	files := []FileInfo{}
+	for file, err := range Walk(root, filter) {
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
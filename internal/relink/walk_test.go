@@ -3,6 +3,7 @@ package relink_test
 import (
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 
 	"github.com/USA-RedDragon/relink/internal/relink"
@@ -66,7 +67,7 @@ func TestWalk(t *testing.T) {
 		}
 
 		foundFiles := make(map[string]bool)
-		for path, err := range relink.Walk(tmpDir) {
+		for path, err := range relink.Walk(tmpDir, nil) {
 			if err != nil {
 				t.Errorf("Unexpected error while walking: %v", err)
 				continue
@@ -90,7 +91,7 @@ func TestWalk(t *testing.T) {
 		nonExistentDir := filepath.Join(t.TempDir(), "does-not-exist")
 
 		foundAny := false
-		for _, err := range relink.Walk(nonExistentDir) {
+		for _, err := range relink.Walk(nonExistentDir, nil) {
 			foundAny = true
 			if err == nil {
 				t.Error("Expected error for non-existent directory, got nil")
@@ -116,7 +117,7 @@ func TestWalk(t *testing.T) {
 		defer os.Remove(rootFile)
 
 		foundRoot := false
-		for path, err := range relink.Walk(tmpDir) {
+		for path, err := range relink.Walk(tmpDir, nil) {
 			if err != nil {
 				t.Errorf("Unexpected error while walking: %v", err)
 				continue
@@ -130,4 +131,173 @@ func TestWalk(t *testing.T) {
 			t.Error("Root directory should be skipped")
 		}
 	})
+
+	t.Run("prunes excluded directories", func(t *testing.T) {
+		t.Parallel()
+		tmpDir, cleanup := setupTestDir(t)
+		defer cleanup()
+
+		filter, err := relink.NewFilter(nil, []string{"subdir/nested", "file1.txt"})
+		if err != nil {
+			t.Fatalf("Failed to create filter: %v", err)
+		}
+
+		expectedFiles := []string{
+			filepath.Join(tmpDir, "file2.txt"),
+			filepath.Join(tmpDir, "subdir/file3.txt"),
+		}
+		assertWalked(t, tmpDir, filter, expectedFiles)
+	})
+
+	t.Run("only walks included files", func(t *testing.T) {
+		t.Parallel()
+		tmpDir, cleanup := setupTestDir(t)
+		defer cleanup()
+
+		filter, err := relink.NewFilter([]string{"subdir/**/file[34].txt"}, nil)
+		if err != nil {
+			t.Fatalf("Failed to create filter: %v", err)
+		}
+
+		expectedFiles := []string{
+			filepath.Join(tmpDir, "subdir/file3.txt"),
+			filepath.Join(tmpDir, "subdir/nested/file4.txt"),
+		}
+		assertWalked(t, tmpDir, filter, expectedFiles)
+	})
+
+	t.Run("matches regular expressions against the relative path", func(t *testing.T) {
+		t.Parallel()
+		tmpDir, cleanup := setupTestDir(t)
+		defer cleanup()
+
+		filter, err := relink.NewFilter([]string{"regex:^file[0-9]\\.txt$"}, []string{"regex:2"})
+		if err != nil {
+			t.Fatalf("Failed to create filter: %v", err)
+		}
+
+		expectedFiles := []string{
+			filepath.Join(tmpDir, "file1.txt"),
+		}
+		assertWalked(t, tmpDir, filter, expectedFiles)
+	})
+
+	t.Run("applies ignore files to their subtree", func(t *testing.T) {
+		t.Parallel()
+		tmpDir, cleanup := setupTestDir(t)
+		defer cleanup()
+
+		ignores := map[string]string{
+			relink.IgnoreFile:                             "file2.txt\nnested/\n",
+			filepath.Join("subdir", relink.IgnoreFile):    "*.txt\n",
+			filepath.Join("empty_dir", relink.IgnoreFile): "!file2.txt\n",
+		}
+		for name, content := range ignores {
+			err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0600)
+			if err != nil {
+				t.Fatalf("Failed to create ignore file: %v", err)
+			}
+		}
+		err := os.WriteFile(filepath.Join(tmpDir, "empty_dir", "file2.txt"), []byte("content2"), 0600)
+		if err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+
+		expectedFiles := []string{
+			filepath.Join(tmpDir, "file1.txt"),
+			filepath.Join(tmpDir, "empty_dir", "file2.txt"),
+		}
+		assertWalked(t, tmpDir, nil, expectedFiles)
+	})
+
+	t.Run("skips directories that can't be read", func(t *testing.T) {
+		t.Parallel()
+		if os.Geteuid() == 0 {
+			t.Skip("Root can read every directory")
+		}
+		tmpDir, cleanup := setupTestDir(t)
+		defer cleanup()
+
+		// subdir can't be entered at all, while nested can be entered but
+		// not listed
+		locked := filepath.Join(tmpDir, "subdir")
+		unlisted := filepath.Join(tmpDir, "subdir", "nested")
+		if err := os.Chmod(unlisted, 0300); err != nil {
+			t.Fatalf("Failed to chmod directory: %v", err)
+		}
+		if err := os.Chmod(locked, 0); err != nil {
+			t.Fatalf("Failed to chmod directory: %v", err)
+		}
+		defer os.Chmod(unlisted, 0755) //nolint:errcheck
+		defer os.Chmod(locked, 0755)   //nolint:errcheck
+
+		expectedFiles := []string{
+			filepath.Join(tmpDir, "file1.txt"),
+			filepath.Join(tmpDir, "file2.txt"),
+		}
+		assertWalked(t, tmpDir, nil, expectedFiles)
+
+		if err := os.Chmod(locked, 0755); err != nil {
+			t.Fatalf("Failed to chmod directory: %v", err)
+		}
+		expectedFiles = append(expectedFiles, filepath.Join(tmpDir, "subdir", "file3.txt"))
+		assertWalked(t, tmpDir, nil, expectedFiles)
+	})
+
+	t.Run("skips files outside the size limits", func(t *testing.T) {
+		t.Parallel()
+		tmpDir, cleanup := setupTestDir(t)
+		defer cleanup()
+
+		err := os.WriteFile(filepath.Join(tmpDir, "file2.txt"), []byte("a longer file"), 0600)
+		if err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		err = os.WriteFile(filepath.Join(tmpDir, "subdir", "file3.txt"), []byte("x"), 0600)
+		if err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+
+		filter, err := relink.NewFilter(nil, nil)
+		if err != nil {
+			t.Fatalf("Failed to create filter: %v", err)
+		}
+		filter.MinSize = 2
+		filter.MaxSize = 8
+
+		expectedFiles := []string{
+			filepath.Join(tmpDir, "file1.txt"),
+			filepath.Join(tmpDir, "subdir/nested/file4.txt"),
+		}
+		assertWalked(t, tmpDir, filter, expectedFiles)
+	})
+}
+
+func TestNewFilterInvalidPattern(t *testing.T) {
+	t.Parallel()
+
+	for _, pattern := range []string{"[", "regex:("} {
+		_, err := relink.NewFilter([]string{pattern}, nil)
+		if err == nil {
+			t.Errorf("Expected error for pattern %q, got nil", pattern)
+		}
+	}
+}
+
+func assertWalked(t *testing.T, root string, filter *relink.Filter, expected []string) {
+	t.Helper()
+
+	found := []string{}
+	for file, err := range relink.Walk(root, filter) {
+		if err != nil {
+			t.Fatalf("Unexpected error while walking: %v", err)
+		}
+		found = append(found, file.Path)
+	}
+
+	slices.Sort(found)
+	slices.Sort(expected)
+	if !slices.Equal(found, expected) {
+		t.Errorf("Expected files %v, got %v", expected, found)
+	}
 }
@@ -1,6 +1,15 @@
 package utils
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidSize = errors.New("invalid size")
 
 func HumanReadableSize(bytes uint64) string {
 	const unit = 1024
@@ -15,3 +24,54 @@ func HumanReadableSize(bytes uint64) string {
 	prefix := []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}[exp]
 	return fmt.Sprintf("%.1f %s", float64(bytes)/float64(div), prefix)
 }
+
+// ParseSize parses a size in bytes with an optional unit, like 512, 4K,
+// 1.5MiB, or 10GB. Binary units and bare prefixes are powers of 1024, and
+// decimal units like KB are powers of 1000. An empty string is 0.
+func ParseSize(size string) (uint64, error) {
+	size = strings.TrimSpace(size)
+	if size == "" {
+		return 0, nil
+	}
+
+	number := strings.TrimRightFunc(size, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	unit := strings.ToLower(strings.TrimSpace(size[len(number):]))
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidSize, size)
+	}
+
+	multiplier := 1.0
+	if unit != "" && unit != "b" {
+		exp := strings.IndexByte("kmgtpe", unit[0]) + 1
+		if exp == 0 {
+			return 0, fmt.Errorf("%w: unknown unit in %q", ErrInvalidSize, size)
+		}
+		switch unit[1:] {
+		case "", "i", "ib":
+			multiplier = math.Pow(1024, float64(exp))
+		case "b":
+			multiplier = math.Pow(1000, float64(exp))
+		default:
+			return 0, fmt.Errorf("%w: unknown unit in %q", ErrInvalidSize, size)
+		}
+	}
+
+	bytes := value * multiplier
+	if bytes >= math.MaxUint64 {
+		return 0, fmt.Errorf("%w: %q is too large", ErrInvalidSize, size)
+	}
+	return uint64(bytes), nil
+}
+
+// IsWithin reports whether path is root or inside it.
+func IsWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
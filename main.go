@@ -28,7 +28,7 @@ func main() {
 		WithFile(&configulator.FileOptions{
 			Paths: []string{"config.yaml"},
 		}).
-		WithPFlags(rootCmd.Flags(), nil)
+		WithPFlags(rootCmd.PersistentFlags(), nil)
 
 	rootCmd.SetContext(c.WithContext(context.TODO()))
 